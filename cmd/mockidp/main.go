@@ -0,0 +1,42 @@
+// Command mockidp is an OpenID Connect provider for local development. It
+// logs everyone in without asking: the user is taken from the login_hint
+// parameter of the authorization request, or -user.
+//
+//	go run ./cmd/mockidp -addr :9000 -client-id file-storage
+//
+// and run the service with OIDC_ISSUER=http://localhost:9000,
+// OIDC_CLIENT_ID=file-storage and
+// OIDC_REDIRECT_URL=http://localhost:8080/api/auth/oidc/callback.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/ArturV19/file-storage/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL")
+	clientID := flag.String("client-id", "file-storage", "accepted client ID, the audience of ID tokens")
+	audience := flag.String("audience", "file-storage-api", "audience of access tokens")
+	scopes := flag.String("scopes", "assets:read assets:write assets:delete", "scope claim of access tokens")
+	user := flag.String("user", "alice", "user logged in without a login_hint")
+	flag.Parse()
+
+	p, err := oidctest.NewProvider(oidctest.Config{
+		Issuer:   *issuer,
+		ClientID: *clientID,
+		Audience: *audience,
+		Scopes:   *scopes,
+		User:     *user,
+	})
+	if err != nil {
+		log.Fatalf("Error creating provider: %v", err)
+	}
+
+	log.Printf("Mock identity provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLoginMinLength            = 3
+	defaultLoginMaxLength            = 32
+	defaultLoginPattern              = `^[A-Za-z0-9][A-Za-z0-9._-]*$`
+	defaultLoginReserved             = "admin,administrator,root,system,api,support,security,null,me"
+	defaultPasswordMinLength         = 8
+	defaultPasswordMaxLength         = 256
+	defaultPasswordMinCharacterKinds = 2
+)
+
+const (
+	envNameLoginMinLength            = "LOGIN_MIN_LENGTH"
+	envNameLoginMaxLength            = "LOGIN_MAX_LENGTH"
+	envNameLoginPattern              = "LOGIN_PATTERN"
+	envNameLoginReserved             = "LOGIN_RESERVED"
+	envNamePasswordMinLength         = "PASSWORD_MIN_LENGTH"
+	envNamePasswordMaxLength         = "PASSWORD_MAX_LENGTH"
+	envNamePasswordMinCharacterKinds = "PASSWORD_MIN_CHARACTER_KINDS"
+	envNamePasswordRejectCommon      = "PASSWORD_REJECT_COMMON"
+)
+
+// AccountPolicyConfig are the rules for logins and passwords of new users
+// and for new passwords. Lengths count characters, not bytes.
+type AccountPolicyConfig struct {
+	LoginMinLength int
+	LoginMaxLength int
+	// LoginPattern is the regular expression logins have to match.
+	LoginPattern string
+	// LoginReserved are logins nobody can register, compared case
+	// insensitively.
+	LoginReserved []string
+
+	PasswordMinLength int
+	PasswordMaxLength int
+	// PasswordMinCharacterKinds is how many of lower case letters, upper case
+	// letters, digits and other characters a password has to contain.
+	PasswordMinCharacterKinds int
+	// PasswordRejectCommon rejects passwords from the bundled list of common
+	// and breached passwords.
+	PasswordRejectCommon bool
+}
+
+func newDefaultAccountPolicyConfig() AccountPolicyConfig {
+	return AccountPolicyConfig{
+		LoginMinLength:            defaultLoginMinLength,
+		LoginMaxLength:            defaultLoginMaxLength,
+		LoginPattern:              defaultLoginPattern,
+		LoginReserved:             strings.Split(defaultLoginReserved, ","),
+		PasswordMinLength:         defaultPasswordMinLength,
+		PasswordMaxLength:         defaultPasswordMaxLength,
+		PasswordMinCharacterKinds: defaultPasswordMinCharacterKinds,
+		PasswordRejectCommon:      true,
+	}
+}
+
+func (c *AccountPolicyConfig) parseEnv() error {
+	if err := parseEnvInt(envNameLoginMinLength, &c.LoginMinLength, 1); err != nil {
+		return err
+	}
+	if err := parseEnvInt(envNameLoginMaxLength, &c.LoginMaxLength, 1); err != nil {
+		return err
+	}
+
+	envLoginPattern := os.Getenv(envNameLoginPattern)
+	if envLoginPattern != "" {
+		if _, err := regexp.Compile(envLoginPattern); err != nil {
+			return fmt.Errorf("parse %s: %w", envNameLoginPattern, err)
+		}
+		c.LoginPattern = envLoginPattern
+	}
+
+	envLoginReserved := os.Getenv(envNameLoginReserved)
+	if envLoginReserved != "" {
+		c.LoginReserved = nil
+		for _, login := range strings.Split(envLoginReserved, ",") {
+			if login = strings.TrimSpace(login); login != "" {
+				c.LoginReserved = append(c.LoginReserved, login)
+			}
+		}
+	}
+
+	if err := parseEnvInt(envNamePasswordMinLength, &c.PasswordMinLength, 1); err != nil {
+		return err
+	}
+	if err := parseEnvInt(envNamePasswordMaxLength, &c.PasswordMaxLength, 1); err != nil {
+		return err
+	}
+	if err := parseEnvInt(envNamePasswordMinCharacterKinds, &c.PasswordMinCharacterKinds, 1); err != nil {
+		return err
+	}
+	if c.PasswordMinCharacterKinds > 4 {
+		return fmt.Errorf("parse %s: at most 4 character kinds", envNamePasswordMinCharacterKinds)
+	}
+
+	envRejectCommon := os.Getenv(envNamePasswordRejectCommon)
+	if envRejectCommon != "" {
+		reject, err := strconv.ParseBool(envRejectCommon)
+		if err != nil {
+			return fmt.Errorf("parse %s: %s", envNamePasswordRejectCommon, envRejectCommon)
+		}
+		c.PasswordRejectCommon = reject
+	}
+
+	if c.LoginMaxLength < c.LoginMinLength {
+		return fmt.Errorf("%s is below %s", envNameLoginMaxLength, envNameLoginMinLength)
+	}
+	if c.PasswordMaxLength < c.PasswordMinLength {
+		return fmt.Errorf("%s is below %s", envNamePasswordMaxLength, envNamePasswordMinLength)
+	}
+
+	return nil
+}
+
+// parseEnvInt sets *value from the environment variable if it is set. Values
+// below min are rejected.
+func parseEnvInt(name string, value *int, min int) error {
+	env := os.Getenv(name)
+	if env == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(env)
+	if err != nil || parsed < min {
+		return fmt.Errorf("parse %s: %s", name, env)
+	}
+	*value = parsed
+
+	return nil
+}
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPasswordArgon2Memory  = 19 * 1024 // KiB
+	defaultPasswordArgon2Time    = 2
+	defaultPasswordArgon2Threads = 1
+	defaultAccessTokenTTL        = 15 * time.Minute
+	defaultRefreshTokenTTL       = 30 * 24 * time.Hour
+	defaultTokenMode             = TokenModeSession
+	defaultLoginBackoffAfter     = 3
+	defaultLoginBackoffBase      = 1 * time.Second
+	defaultLoginLockoutAfter     = 10
+	defaultLoginIPLockoutAfter   = 50
+	defaultLoginLockoutDuration  = 15 * time.Minute
+	defaultPasswordResetTTL      = 1 * time.Hour
+)
+
+const (
+	// TokenModeSession issues opaque session tokens that are looked up in the
+	// database on every request.
+	TokenModeSession = "session"
+	// TokenModeSigned issues signed tokens that are verified without a
+	// database lookup.
+	TokenModeSigned = "signed"
+)
+
+const (
+	envNamePasswordArgon2Memory  = "PASSWORD_ARGON2_MEMORY"
+	envNamePasswordArgon2Time    = "PASSWORD_ARGON2_TIME"
+	envNamePasswordArgon2Threads = "PASSWORD_ARGON2_THREADS"
+	envNameURLSigningKey         = "URL_SIGNING_KEY"
+	envNameAccessTokenTTL        = "ACCESS_TOKEN_TTL"
+	envNameRefreshTokenTTL       = "REFRESH_TOKEN_TTL"
+	envNameSlidingSessions       = "SESSION_SLIDING_EXPIRATION"
+	envNameTokenMode             = "AUTH_TOKEN_MODE"
+	envNameTokenSigningKeys      = "TOKEN_SIGNING_KEYS"
+	envNameLoginBackoffAfter     = "LOGIN_BACKOFF_AFTER"
+	envNameLoginBackoffBase      = "LOGIN_BACKOFF_BASE"
+	envNameLoginLockoutAfter     = "LOGIN_LOCKOUT_AFTER"
+	envNameLoginIPLockoutAfter   = "LOGIN_IP_LOCKOUT_AFTER"
+	envNameLoginLockoutDuration  = "LOGIN_LOCKOUT_DURATION"
+	envNamePasswordResetTTL      = "PASSWORD_RESET_TOKEN_TTL"
+	envNameAdminLogins           = "ADMIN_LOGINS"
+)
+
+type AuthConfig struct {
+	// PasswordArgon2Memory is the argon2id memory cost in KiB.
+	PasswordArgon2Memory  uint32
+	PasswordArgon2Time    uint32
+	PasswordArgon2Threads uint8
+
+	// URLSigningKey signs presigned URLs. If empty a random key is generated
+	// on startup and URLs stop working after a restart.
+	URLSigningKey string
+
+	// AccessTokenTTL is the lifetime of session tokens. RefreshTokenTTL
+	// bounds how long a session can be renewed with refresh tokens.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// SlidingSessions extends a session token by AccessTokenTTL every time
+	// it is used, so only idle sessions expire.
+	SlidingSessions bool
+
+	// TokenMode is TokenModeSession or TokenModeSigned.
+	TokenMode string
+	// TokenSigningKeys sign and verify access tokens in the signed token
+	// mode. The first key signs new tokens, all of them verify.
+	TokenSigningKeys []SigningKey
+
+	// Failed logins are counted per account and per IP address. After
+	// LoginBackoffAfter failures every further attempt has to wait
+	// LoginBackoffBase, doubled with each failure. LoginLockoutAfter failures
+	// of an account, or LoginIPLockoutAfter failures from an address, lock
+	// it for LoginLockoutDuration. Failures older than LoginLockoutDuration
+	// are forgotten.
+	LoginBackoffAfter    int
+	LoginBackoffBase     time.Duration
+	LoginLockoutAfter    int
+	LoginIPLockoutAfter  int
+	LoginLockoutDuration time.Duration
+
+	// PasswordResetTTL is how long a password reset token can be used.
+	PasswordResetTTL time.Duration
+
+	// AdminLogins are given the admin role on startup while there is no
+	// admin, so the first administrator can be set up. Users the role was
+	// revoked from don't get it back, and the role is never taken away here.
+	AdminLogins []string
+
+	AccountPolicy AccountPolicyConfig
+
+	OIDC           OIDCConfig
+	ExternalTokens ExternalTokenConfig
+}
+
+type SigningKey struct {
+	ID     string
+	Secret string
+}
+
+func newDefaultAuthConfig() AuthConfig {
+	return AuthConfig{
+		PasswordArgon2Memory:  defaultPasswordArgon2Memory,
+		PasswordArgon2Time:    defaultPasswordArgon2Time,
+		PasswordArgon2Threads: defaultPasswordArgon2Threads,
+		AccessTokenTTL:        defaultAccessTokenTTL,
+		RefreshTokenTTL:       defaultRefreshTokenTTL,
+		TokenMode:             defaultTokenMode,
+		LoginBackoffAfter:     defaultLoginBackoffAfter,
+		LoginBackoffBase:      defaultLoginBackoffBase,
+		LoginLockoutAfter:     defaultLoginLockoutAfter,
+		LoginIPLockoutAfter:   defaultLoginIPLockoutAfter,
+		LoginLockoutDuration:  defaultLoginLockoutDuration,
+		PasswordResetTTL:      defaultPasswordResetTTL,
+		AccountPolicy:         newDefaultAccountPolicyConfig(),
+		OIDC:                  newDefaultOIDCConfig(),
+		ExternalTokens:        newDefaultExternalTokenConfig(),
+	}
+}
+
+func (c *AuthConfig) parseEnv() error {
+	envArgon2Memory := os.Getenv(envNamePasswordArgon2Memory)
+	if envArgon2Memory != "" {
+		memory, err := strconv.ParseUint(envArgon2Memory, 10, 32)
+		if err != nil || memory == 0 {
+			return fmt.Errorf("parse %s: %s", envNamePasswordArgon2Memory, envArgon2Memory)
+		}
+		c.PasswordArgon2Memory = uint32(memory)
+	}
+
+	envArgon2Time := os.Getenv(envNamePasswordArgon2Time)
+	if envArgon2Time != "" {
+		iterations, err := strconv.ParseUint(envArgon2Time, 10, 32)
+		if err != nil || iterations == 0 {
+			return fmt.Errorf("parse %s: %s", envNamePasswordArgon2Time, envArgon2Time)
+		}
+		c.PasswordArgon2Time = uint32(iterations)
+	}
+
+	envArgon2Threads := os.Getenv(envNamePasswordArgon2Threads)
+	if envArgon2Threads != "" {
+		threads, err := strconv.ParseUint(envArgon2Threads, 10, 8)
+		if err != nil || threads == 0 {
+			return fmt.Errorf("parse %s: %s", envNamePasswordArgon2Threads, envArgon2Threads)
+		}
+		c.PasswordArgon2Threads = uint8(threads)
+	}
+
+	envURLSigningKey := os.Getenv(envNameURLSigningKey)
+	if envURLSigningKey != "" {
+		c.URLSigningKey = envURLSigningKey
+	}
+
+	envAccessTokenTTL := os.Getenv(envNameAccessTokenTTL)
+	if envAccessTokenTTL != "" {
+		ttl, err := time.ParseDuration(envAccessTokenTTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("parse %s: %s", envNameAccessTokenTTL, envAccessTokenTTL)
+		}
+		c.AccessTokenTTL = ttl
+	}
+
+	envRefreshTokenTTL := os.Getenv(envNameRefreshTokenTTL)
+	if envRefreshTokenTTL != "" {
+		ttl, err := time.ParseDuration(envRefreshTokenTTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("parse %s: %s", envNameRefreshTokenTTL, envRefreshTokenTTL)
+		}
+		c.RefreshTokenTTL = ttl
+	}
+
+	envSlidingSessions := os.Getenv(envNameSlidingSessions)
+	if envSlidingSessions != "" {
+		sliding, err := strconv.ParseBool(envSlidingSessions)
+		if err != nil {
+			return fmt.Errorf("parse %s: %s", envNameSlidingSessions, envSlidingSessions)
+		}
+		c.SlidingSessions = sliding
+	}
+
+	envTokenMode := os.Getenv(envNameTokenMode)
+	if envTokenMode != "" {
+		if envTokenMode != TokenModeSession && envTokenMode != TokenModeSigned {
+			return fmt.Errorf("parse %s: %s", envNameTokenMode, envTokenMode)
+		}
+		c.TokenMode = envTokenMode
+	}
+
+	// TOKEN_SIGNING_KEYS is a comma separated list of id:secret pairs.
+	envTokenSigningKeys := os.Getenv(envNameTokenSigningKeys)
+	if envTokenSigningKeys != "" {
+		c.TokenSigningKeys = nil
+		for _, pair := range strings.Split(envTokenSigningKeys, ",") {
+			id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok || id == "" || secret == "" {
+				return fmt.Errorf("parse %s: invalid key %q", envNameTokenSigningKeys, id)
+			}
+			c.TokenSigningKeys = append(c.TokenSigningKeys, SigningKey{ID: id, Secret: secret})
+		}
+	}
+
+	envLoginBackoffAfter := os.Getenv(envNameLoginBackoffAfter)
+	if envLoginBackoffAfter != "" {
+		failures, err := strconv.Atoi(envLoginBackoffAfter)
+		if err != nil || failures <= 0 {
+			return fmt.Errorf("parse %s: %s", envNameLoginBackoffAfter, envLoginBackoffAfter)
+		}
+		c.LoginBackoffAfter = failures
+	}
+
+	envLoginBackoffBase := os.Getenv(envNameLoginBackoffBase)
+	if envLoginBackoffBase != "" {
+		backoff, err := time.ParseDuration(envLoginBackoffBase)
+		if err != nil || backoff <= 0 {
+			return fmt.Errorf("parse %s: %s", envNameLoginBackoffBase, envLoginBackoffBase)
+		}
+		c.LoginBackoffBase = backoff
+	}
+
+	envLoginLockoutAfter := os.Getenv(envNameLoginLockoutAfter)
+	if envLoginLockoutAfter != "" {
+		failures, err := strconv.Atoi(envLoginLockoutAfter)
+		if err != nil || failures <= 0 {
+			return fmt.Errorf("parse %s: %s", envNameLoginLockoutAfter, envLoginLockoutAfter)
+		}
+		c.LoginLockoutAfter = failures
+	}
+
+	envLoginIPLockoutAfter := os.Getenv(envNameLoginIPLockoutAfter)
+	if envLoginIPLockoutAfter != "" {
+		failures, err := strconv.Atoi(envLoginIPLockoutAfter)
+		if err != nil || failures <= 0 {
+			return fmt.Errorf("parse %s: %s", envNameLoginIPLockoutAfter, envLoginIPLockoutAfter)
+		}
+		c.LoginIPLockoutAfter = failures
+	}
+
+	envLoginLockoutDuration := os.Getenv(envNameLoginLockoutDuration)
+	if envLoginLockoutDuration != "" {
+		duration, err := time.ParseDuration(envLoginLockoutDuration)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("parse %s: %s", envNameLoginLockoutDuration, envLoginLockoutDuration)
+		}
+		c.LoginLockoutDuration = duration
+	}
+
+	envPasswordResetTTL := os.Getenv(envNamePasswordResetTTL)
+	if envPasswordResetTTL != "" {
+		ttl, err := time.ParseDuration(envPasswordResetTTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("parse %s: %s", envNamePasswordResetTTL, envPasswordResetTTL)
+		}
+		c.PasswordResetTTL = ttl
+	}
+
+	// ADMIN_LOGINS is a comma separated list of logins.
+	envAdminLogins := os.Getenv(envNameAdminLogins)
+	if envAdminLogins != "" {
+		c.AdminLogins = nil
+		for _, login := range strings.Split(envAdminLogins, ",") {
+			if login = strings.TrimSpace(login); login != "" {
+				c.AdminLogins = append(c.AdminLogins, login)
+			}
+		}
+	}
+
+	if err := c.AccountPolicy.parseEnv(); err != nil {
+		return err
+	}
+
+	if err := c.OIDC.parseEnv(); err != nil {
+		return err
+	}
+
+	if err := c.ExternalTokens.parseEnv(); err != nil {
+		return err
+	}
+
+	if c.TokenMode == TokenModeSigned && len(c.TokenSigningKeys) == 0 {
+		return fmt.Errorf("%s is required with %s=%s", envNameTokenSigningKeys, envNameTokenMode, TokenModeSigned)
+	}
+
+	return nil
+}
@@ -13,6 +13,8 @@ const (
 type Config struct {
 	HTTPConfig HTTPConfig
 	Storage    StorageConfig
+	Auth       AuthConfig
+	Notifier   NotifierConfig
 	LogLvl     string
 }
 
@@ -20,13 +22,26 @@ func NewDefaultConfig() Config {
 	return Config{
 		HTTPConfig: newDefaultHTTPConfig(),
 		Storage:    newDefaultStorageConfig(),
+		Auth:       newDefaultAuthConfig(),
+		Notifier:   newDefaultNotifierConfig(),
 		LogLvl:     defaultLogLvl,
 	}
 }
 
 func (c *Config) ParseEnv() error {
 	c.HTTPConfig.parseEnv()
-	c.Storage.parseEnv()
+
+	if err := c.Storage.parseEnv(); err != nil {
+		return err
+	}
+
+	if err := c.Auth.parseEnv(); err != nil {
+		return err
+	}
+
+	if err := c.Notifier.parseEnv(); err != nil {
+		return err
+	}
 
 	if err := c.parseEnvLogLvl(); err != nil {
 		return err
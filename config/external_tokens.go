@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const defaultExternalTokenUserClaim = "sub"
+
+const (
+	envNameExternalTokenIssuer     = "EXTERNAL_TOKEN_ISSUER"
+	envNameExternalTokenAudience   = "EXTERNAL_TOKEN_AUDIENCE"
+	envNameExternalTokenJWKSURL    = "EXTERNAL_TOKEN_JWKS_URL"
+	envNameExternalTokenUserClaim  = "EXTERNAL_TOKEN_USER_CLAIM"
+	envNameExternalTokenUserLogins = "EXTERNAL_TOKEN_USER_LOGINS"
+)
+
+// ExternalTokenConfig configures the verification of JWT access tokens issued
+// by an identity provider. Verification is enabled when Issuer is set.
+type ExternalTokenConfig struct {
+	// Issuer is matched exactly against the iss claim, including a trailing
+	// slash.
+	Issuer   string
+	Audience string
+	// JWKSURL is where the provider's keys are fetched from. If empty it is
+	// discovered from Issuer without a trailing slash +
+	// "/.well-known/openid-configuration".
+	JWKSURL string
+	// UserClaim maps tokens to local users. The sub claim is matched against
+	// the subject IDs of users provisioned through OpenID Connect login, any
+	// other claim against the logins of those users and of UserLogins. Other
+	// claims are only as trustworthy as the provider's rules for them.
+	UserClaim string
+	// UserLogins are local users, usually service accounts, that a claim
+	// other than sub may also map to.
+	UserLogins []string
+}
+
+func newDefaultExternalTokenConfig() ExternalTokenConfig {
+	return ExternalTokenConfig{
+		UserClaim: defaultExternalTokenUserClaim,
+	}
+}
+
+func (c *ExternalTokenConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+func (c *ExternalTokenConfig) parseEnv() error {
+	c.Issuer = os.Getenv(envNameExternalTokenIssuer)
+	c.Audience = os.Getenv(envNameExternalTokenAudience)
+	c.JWKSURL = os.Getenv(envNameExternalTokenJWKSURL)
+
+	envUserClaim := os.Getenv(envNameExternalTokenUserClaim)
+	if envUserClaim != "" {
+		c.UserClaim = envUserClaim
+	}
+
+	// EXTERNAL_TOKEN_USER_LOGINS is a comma separated list of logins.
+	envUserLogins := os.Getenv(envNameExternalTokenUserLogins)
+	for _, login := range strings.Split(envUserLogins, ",") {
+		if login = strings.TrimSpace(login); login != "" {
+			c.UserLogins = append(c.UserLogins, login)
+		}
+	}
+
+	if c.Enabled() && c.Audience == "" {
+		return fmt.Errorf("%s is required with %s", envNameExternalTokenAudience, envNameExternalTokenIssuer)
+	}
+	if len(c.UserLogins) > 0 && c.UserClaim == "sub" {
+		return fmt.Errorf("%s requires a %s other than sub", envNameExternalTokenUserLogins, envNameExternalTokenUserClaim)
+	}
+
+	return nil
+}
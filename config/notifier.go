@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// NotifierNone disables password resets, there is no way to deliver
+	// the tokens.
+	NotifierNone = "none"
+	// NotifierLog writes notifications to the service log.
+	NotifierLog = "log"
+	// NotifierFile appends notifications to a file as JSON lines.
+	NotifierFile = "file"
+)
+
+const (
+	defaultNotifierBackend = NotifierNone
+	defaultNotifierFile    = "./notifications.log"
+)
+
+const (
+	envNameNotifierBackend = "NOTIFIER"
+	envNameNotifierFile    = "NOTIFIER_FILE"
+)
+
+// NotifierConfig selects how messages to users, such as password reset
+// tokens, are delivered.
+type NotifierConfig struct {
+	Backend string
+	File    string
+}
+
+func newDefaultNotifierConfig() NotifierConfig {
+	return NotifierConfig{
+		Backend: defaultNotifierBackend,
+		File:    defaultNotifierFile,
+	}
+}
+
+func (c *NotifierConfig) parseEnv() error {
+	envBackend := os.Getenv(envNameNotifierBackend)
+	if envBackend != "" {
+		if envBackend != NotifierNone && envBackend != NotifierLog && envBackend != NotifierFile {
+			return fmt.Errorf("parse %s: %s", envNameNotifierBackend, envBackend)
+		}
+		c.Backend = envBackend
+	}
+
+	envFile := os.Getenv(envNameNotifierFile)
+	if envFile != "" {
+		c.File = envFile
+	}
+
+	return nil
+}
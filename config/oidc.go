@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const defaultOIDCScopes = "openid profile email"
+
+const (
+	envNameOIDCIssuer       = "OIDC_ISSUER"
+	envNameOIDCClientID     = "OIDC_CLIENT_ID"
+	envNameOIDCClientSecret = "OIDC_CLIENT_SECRET"
+	envNameOIDCRedirectURL  = "OIDC_REDIRECT_URL"
+	envNameOIDCScopes       = "OIDC_SCOPES"
+)
+
+// OIDCConfig configures login through an OpenID Connect identity provider.
+// Login is enabled when Issuer is set.
+type OIDCConfig struct {
+	// Issuer is the issuer URL exactly as it appears in the iss claim, some
+	// providers end it with a slash. The provider configuration is discovered
+	// from Issuer without the slash + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered with the provider, it has to
+	// point at /api/auth/oidc/callback.
+	RedirectURL string
+	Scopes      []string
+}
+
+func newDefaultOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		Scopes: strings.Fields(defaultOIDCScopes),
+	}
+}
+
+func (c *OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+func (c *OIDCConfig) parseEnv() error {
+	c.Issuer = os.Getenv(envNameOIDCIssuer)
+	c.ClientID = os.Getenv(envNameOIDCClientID)
+	c.ClientSecret = os.Getenv(envNameOIDCClientSecret)
+	c.RedirectURL = os.Getenv(envNameOIDCRedirectURL)
+
+	envScopes := os.Getenv(envNameOIDCScopes)
+	if envScopes != "" {
+		c.Scopes = strings.Fields(envScopes)
+	}
+
+	if !c.Enabled() {
+		return nil
+	}
+
+	if c.ClientID == "" || c.RedirectURL == "" {
+		return fmt.Errorf("%s and %s are required with %s", envNameOIDCClientID, envNameOIDCRedirectURL, envNameOIDCIssuer)
+	}
+
+	hasOpenID := false
+	for _, scope := range c.Scopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		return fmt.Errorf("parse %s: openid scope is required", envNameOIDCScopes)
+	}
+
+	return nil
+}
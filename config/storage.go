@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 )
 
 const (
@@ -10,13 +12,27 @@ const (
 	defaultStorageUser       = "admin"
 	defaultStoragePassword   = "password"
 	defaultFileStorageDBName = "file_storage"
+	defaultStorageBackend    = "postgres"
+	defaultStorageLocalDir   = "./data"
+	defaultStorageS3Region   = "us-east-1"
+	defaultStorageS3PartSize = 16 * 1024 * 1024 // 16MB
 )
 const (
-	envNameStorageHost     = "DB_HOST"
-	envNameStoragePort     = "DB_PORT"
-	envNameStorageUser     = "DB_USER"
-	envNameStoragePassword = "DB_PASSWORD"
-	envNameDBName          = "DB_NAME"
+	envNameStorageHost        = "DB_HOST"
+	envNameStoragePort        = "DB_PORT"
+	envNameStorageUser        = "DB_USER"
+	envNameStoragePassword    = "DB_PASSWORD"
+	envNameDBName             = "DB_NAME"
+	envNameStorageBackend     = "STORAGE_BACKEND"
+	envNameStorageLocalDir    = "STORAGE_LOCAL_DIR"
+	envNameStorageS3Endpoint  = "STORAGE_S3_ENDPOINT"
+	envNameStorageS3Region    = "STORAGE_S3_REGION"
+	envNameStorageS3Bucket    = "STORAGE_S3_BUCKET"
+	envNameStorageS3AccessKey = "STORAGE_S3_ACCESS_KEY"
+	envNameStorageS3SecretKey = "STORAGE_S3_SECRET_KEY"
+	envNameStorageS3UseSSL    = "STORAGE_S3_USE_SSL"
+	envNameStorageS3PartSize  = "STORAGE_S3_PART_SIZE"
+	envNameStorageVersioning  = "STORAGE_VERSIONING"
 )
 
 type StorageConfig struct {
@@ -25,19 +41,41 @@ type StorageConfig struct {
 	User     string
 	Password string
 	DBName   string
+
+	// Backend selects where asset bytes are kept: "postgres" (large objects
+	// in the metadata database), "local" (files under LocalDir) or "s3"
+	// (objects in an S3-compatible bucket).
+	Backend  string
+	LocalDir string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+	S3PartSize  int64
+
+	// Versioning keeps every upload of an existing asset name as a new
+	// version instead of rejecting it.
+	Versioning bool
 }
 
 func newDefaultStorageConfig() StorageConfig {
 	return StorageConfig{
-		Host:     defaultStorageHost,
-		Port:     defaultStoragePort,
-		User:     defaultStorageUser,
-		Password: defaultStoragePassword,
-		DBName:   defaultFileStorageDBName,
+		Host:       defaultStorageHost,
+		Port:       defaultStoragePort,
+		User:       defaultStorageUser,
+		Password:   defaultStoragePassword,
+		DBName:     defaultFileStorageDBName,
+		Backend:    defaultStorageBackend,
+		LocalDir:   defaultStorageLocalDir,
+		S3Region:   defaultStorageS3Region,
+		S3PartSize: defaultStorageS3PartSize,
 	}
 }
 
-func (c *StorageConfig) parseEnv() {
+func (c *StorageConfig) parseEnv() error {
 	envHost := os.Getenv(envNameStorageHost)
 	if envHost != "" {
 		c.Host = envHost
@@ -62,4 +100,68 @@ func (c *StorageConfig) parseEnv() {
 	if envDBName != "" {
 		c.DBName = envDBName
 	}
+
+	envBackend := os.Getenv(envNameStorageBackend)
+	if envBackend != "" {
+		c.Backend = envBackend
+	}
+
+	envLocalDir := os.Getenv(envNameStorageLocalDir)
+	if envLocalDir != "" {
+		c.LocalDir = envLocalDir
+	}
+
+	envS3Endpoint := os.Getenv(envNameStorageS3Endpoint)
+	if envS3Endpoint != "" {
+		c.S3Endpoint = envS3Endpoint
+	}
+
+	envS3Region := os.Getenv(envNameStorageS3Region)
+	if envS3Region != "" {
+		c.S3Region = envS3Region
+	}
+
+	envS3Bucket := os.Getenv(envNameStorageS3Bucket)
+	if envS3Bucket != "" {
+		c.S3Bucket = envS3Bucket
+	}
+
+	envS3AccessKey := os.Getenv(envNameStorageS3AccessKey)
+	if envS3AccessKey != "" {
+		c.S3AccessKey = envS3AccessKey
+	}
+
+	envS3SecretKey := os.Getenv(envNameStorageS3SecretKey)
+	if envS3SecretKey != "" {
+		c.S3SecretKey = envS3SecretKey
+	}
+
+	envS3UseSSL := os.Getenv(envNameStorageS3UseSSL)
+	if envS3UseSSL != "" {
+		useSSL, err := strconv.ParseBool(envS3UseSSL)
+		if err != nil {
+			return fmt.Errorf("parse %s: %s", envNameStorageS3UseSSL, envS3UseSSL)
+		}
+		c.S3UseSSL = useSSL
+	}
+
+	envS3PartSize := os.Getenv(envNameStorageS3PartSize)
+	if envS3PartSize != "" {
+		partSize, err := strconv.ParseInt(envS3PartSize, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse %s: %s", envNameStorageS3PartSize, envS3PartSize)
+		}
+		c.S3PartSize = partSize
+	}
+
+	envVersioning := os.Getenv(envNameStorageVersioning)
+	if envVersioning != "" {
+		versioning, err := strconv.ParseBool(envVersioning)
+		if err != nil {
+			return fmt.Errorf("parse %s: %s", envNameStorageVersioning, envVersioning)
+		}
+		c.Versioning = versioning
+	}
+
+	return nil
 }
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/notify"
+	"github.com/ArturV19/file-storage/internal/storage"
+)
+
+// Account management:
+//
+//	POST   /api/account/password          {"current_password": "...", "new_password": "..."}, revokes the other sessions
+//	DELETE /api/account                   {"password": "..."}, deletes the user with their sessions and assets
+//	POST   /api/password-reset            {"login": "alice"}, sends a reset token through the notifier
+//	POST   /api/password-reset/confirm    {"token": "...", "new_password": "..."}, revokes all sessions
+//
+// Password changes and account deletion need a session token, and wrong
+// passwords are throttled like failed logins. Reset requests are always
+// accepted so logins can't be probed, but are limited per address. The reset
+// endpoints exist only with a notifier to deliver the tokens.
+const (
+	accountPath              = "/api/account"
+	accountPasswordPath      = "/api/account/password"
+	passwordResetPath        = "/api/password-reset"
+	passwordResetConfirmPath = "/api/password-reset/confirm"
+)
+
+func (a *API) accountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+
+	var req dto.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid IP address", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.userStorage.DeleteAccount(r.Context(), auth.userID, req.Password, ipAddress)
+	if err != nil {
+		var throttled *storage.LoginThrottledError
+		if errors.Is(err, storage.ErrInvalidLoginPassword) {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+		} else if errors.As(err, &throttled) {
+			writeLoginThrottled(w, throttled)
+		} else if errors.Is(err, storage.ErrLastOwner) {
+			http.Error(w, "Transfer the ownership of your organizations first", http.StatusConflict)
+		} else {
+			log.Printf("storage.DeleteAccount error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	a.sessionsRevoked(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+
+	var req dto.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	login, err := a.userStorage.GetUserLogin(r.Context(), auth.userID)
+	if err != nil {
+		log.Printf("storage.GetUserLogin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !writeValidationErrors(w, a.accountPolicy.ValidatePassword(login, req.NewPassword)) {
+		return
+	}
+
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid IP address", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.userStorage.ChangePassword(r.Context(), auth.userID, auth.sessionID, req.CurrentPassword, req.NewPassword, ipAddress)
+	if err != nil {
+		var throttled *storage.LoginThrottledError
+		if errors.Is(err, storage.ErrInvalidLoginPassword) {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+		} else if errors.As(err, &throttled) {
+			writeLoginThrottled(w, throttled)
+		} else {
+			log.Printf("storage.ChangePassword error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	a.sessionsRevoked(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) passwordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req dto.RequestPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	req.Login = strings.TrimSpace(req.Login)
+	if req.Login == "" {
+		http.Error(w, "Empty login", http.StatusBadRequest)
+		return
+	}
+
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid IP address", http.StatusInternalServerError)
+		return
+	}
+
+	token, expiresAt, err := a.userStorage.CreatePasswordResetToken(r.Context(), req.Login, ipAddress)
+	if err != nil {
+		var throttled *storage.LoginThrottledError
+		if errors.As(err, &throttled) {
+			writeTooManyRequests(w, throttled, "Too many password reset requests")
+			return
+		}
+		// Users that got too many tokens recently look like unknown ones.
+		if !errors.Is(err, storage.ErrUserNotFound) && !errors.Is(err, storage.ErrTooManyPasswordResets) {
+			log.Printf("storage.CreatePasswordResetToken error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		reset := notify.PasswordReset{Login: req.Login, Token: token, ExpiresAt: expiresAt}
+		if err := a.notifier.SendPasswordReset(r.Context(), reset); err != nil {
+			log.Printf("notifier.SendPasswordReset error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *API) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req dto.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, "Empty token", http.StatusBadRequest)
+		return
+	}
+
+	login, err := a.userStorage.GetPasswordResetLogin(r.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		} else {
+			log.Printf("storage.GetPasswordResetLogin error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !writeValidationErrors(w, a.accountPolicy.ValidatePassword(login, req.NewPassword)) {
+		return
+	}
+
+	if err := a.userStorage.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, storage.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		} else {
+			log.Printf("storage.ResetPassword error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	a.sessionsRevoked(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
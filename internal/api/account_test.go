@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArturV19/file-storage/internal/notify"
+	"github.com/ArturV19/file-storage/internal/storage"
+)
+
+// resetUserStorage answers password reset requests with a fixed result.
+type resetUserStorage struct {
+	userStorage
+
+	createErr  error
+	resetLogin string
+	resets     int
+}
+
+func (s *resetUserStorage) CreatePasswordResetToken(ctx context.Context, login, ipAddress string) (string, time.Time, error) {
+	if s.createErr != nil {
+		return "", time.Time{}, s.createErr
+	}
+	return "token", time.Now().Add(time.Hour), nil
+}
+
+func (s *resetUserStorage) GetPasswordResetLogin(ctx context.Context, token string) (string, error) {
+	return s.resetLogin, nil
+}
+
+func (s *resetUserStorage) ResetPassword(ctx context.Context, token, newPassword string) error {
+	s.resets++
+	return nil
+}
+
+type recordingNotifier struct {
+	resets []notify.PasswordReset
+}
+
+func (n *recordingNotifier) SendPasswordReset(ctx context.Context, reset notify.PasswordReset) error {
+	n.resets = append(n.resets, reset)
+	return nil
+}
+
+func requestPasswordReset(a *API) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	a.passwordResetHandler(recorder, httptest.NewRequest(http.MethodPost, passwordResetPath, strings.NewReader(`{"login": "alice"}`)))
+	return recorder
+}
+
+func TestPasswordResetSendsToken(t *testing.T) {
+	notifier := &recordingNotifier{}
+	a := &API{userStorage: &resetUserStorage{}, notifier: notifier}
+
+	if recorder := requestPasswordReset(a); recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusAccepted)
+	}
+	if len(notifier.resets) != 1 || notifier.resets[0].Login != "alice" {
+		t.Fatalf("sent %+v, want one reset for alice", notifier.resets)
+	}
+}
+
+func TestPasswordResetHidesUserLimit(t *testing.T) {
+	notifier := &recordingNotifier{}
+	a := &API{userStorage: &resetUserStorage{createErr: storage.ErrTooManyPasswordResets}, notifier: notifier}
+
+	if recorder := requestPasswordReset(a); recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusAccepted)
+	}
+	if len(notifier.resets) != 0 {
+		t.Fatalf("sent %d resets, want none", len(notifier.resets))
+	}
+}
+
+func TestPasswordResetThrottlesAddress(t *testing.T) {
+	a := &API{
+		userStorage: &resetUserStorage{createErr: &storage.LoginThrottledError{RetryAfter: 90 * time.Second}},
+		notifier:    &recordingNotifier{},
+	}
+
+	recorder := requestPasswordReset(a)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "90" {
+		t.Fatalf("Retry-After = %q, want 90", retryAfter)
+	}
+}
+
+func TestConfirmPasswordResetChecksLogin(t *testing.T) {
+	users := &resetUserStorage{resetLogin: "alice"}
+	a := &API{userStorage: users, notifier: &recordingNotifier{}, accountPolicy: testAccountPolicy(t)}
+
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(`{"token": "token", "new_password": "alice"}`)
+	a.confirmPasswordResetHandler(recorder, httptest.NewRequest(http.MethodPost, passwordResetConfirmPath, body))
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "contains_login") {
+		t.Fatalf("response = %d %s, want the contains_login error", recorder.Code, recorder.Body.String())
+	}
+	if users.resets != 0 {
+		t.Fatal("password was reset")
+	}
+}
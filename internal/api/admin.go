@@ -0,0 +1,358 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// The admin API is limited to session tokens of users with the admin role:
+//
+//	GET    /api/admin/users?search=alice                 list users, optionally those whose login contains search
+//	GET    /api/admin/users/{login}                      a user with their storage usage
+//	PATCH  /api/admin/users/{login}                      {"disabled": true, "admin": false}, either field may be left out
+//	DELETE /api/admin/users/{login}/sessions             log the user out everywhere
+//	DELETE /api/admin/users/{login}/login-failures       lift the account's login backoff or lockout
+//	GET    /api/admin/users/{login}/assets               list the user's assets
+//	DELETE /api/admin/users/{login}/assets/{name}        delete an asset, or one version with ?version=
+//	GET    /api/admin/login-lockouts                     list the recorded login lockouts
+//	GET    /api/admin/audit-log                          list the actions taken through the admin API
+//
+// Listings take limit and offset. Every action except reading the audit log
+// is recorded in it.
+const (
+	adminPathPrefix        = "/api/admin/"
+	adminUsersPath         = "users"
+	adminLoginLockoutsPath = "login-lockouts"
+	adminAuditLogPath      = "audit-log"
+	adminSessionsPath      = "sessions"
+	adminLoginFailuresPath = "login-failures"
+	adminAssetsPath        = "assets"
+	adminSearchParam       = "search"
+)
+
+func (a *API) adminHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+
+	admin, err := a.userStorage.IsAdmin(r.Context(), auth.userID)
+	if err != nil {
+		log.Printf("storage.IsAdmin error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !admin {
+		http.Error(w, "Admin role required", http.StatusForbidden)
+		return
+	}
+	adminID := auth.userID
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, adminPathPrefix), "/")
+	switch path {
+	case adminUsersPath:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleListUsers(w, r, adminID)
+		return
+	case adminLoginLockoutsPath:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleListLoginLockouts(w, r, adminID)
+		return
+	case adminAuditLogPath:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleListAuditLog(w, r)
+		return
+	}
+
+	// Asset names may contain slashes, so everything after the assets
+	// segment is the name.
+	segments := strings.SplitN(path, "/", 4)
+	if len(segments) < 2 || segments[0] != adminUsersPath || segments[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	login := segments[1]
+
+	if len(segments) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			a.handleGetUserAccount(w, r, adminID, login)
+		case http.MethodPatch:
+			a.handleUpdateUser(w, r, adminID, login)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch {
+	case segments[2] == adminSessionsPath && len(segments) == 3:
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleRevokeUserSessions(w, r, adminID, login)
+	case segments[2] == adminLoginFailuresPath && len(segments) == 3:
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleClearLoginFailures(w, r, adminID, login)
+	case segments[2] == adminAssetsPath && len(segments) == 3:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleListUserAssets(w, r, adminID, login)
+	case segments[2] == adminAssetsPath && len(segments) == 4 && segments[3] != "":
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleDeleteUserAsset(w, r, adminID, login, segments[3])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *API) handleListUsers(w http.ResponseWriter, r *http.Request, adminID int64) {
+	limit, offset, err := parsePaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	search := strings.TrimSpace(r.URL.Query().Get(adminSearchParam))
+	users, err := a.userStorage.ListUsers(r.Context(), adminID, search, limit, offset)
+	if err != nil {
+		log.Printf("storage.ListUsers error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListUsersResponse{
+		Users: make([]dto.UserAccount, 0, len(users)),
+	}
+	for _, user := range users {
+		resp.Users = append(resp.Users, userAccountResponse(user))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleGetUserAccount(w http.ResponseWriter, r *http.Request, adminID int64, login string) {
+	user, err := a.userStorage.GetUserAccount(r.Context(), adminID, login)
+	if err != nil {
+		writeAdminError(w, "storage.GetUserAccount", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(userAccountResponse(user)); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleUpdateUser(w http.ResponseWriter, r *http.Request, adminID int64, login string) {
+	var req dto.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Admin == nil && req.Disabled == nil {
+		http.Error(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.userStorage.UpdateUser(r.Context(), adminID, login, req.Admin, req.Disabled); err != nil {
+		writeAdminError(w, "storage.UpdateUser", err)
+		return
+	}
+	if req.Disabled != nil && *req.Disabled {
+		a.sessionsRevoked(r.Context())
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleRevokeUserSessions(w http.ResponseWriter, r *http.Request, adminID int64, login string) {
+	revoked, err := a.userStorage.RevokeUserSessions(r.Context(), adminID, login)
+	if err != nil {
+		writeAdminError(w, "storage.RevokeUserSessions", err)
+		return
+	}
+	a.sessionsRevoked(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dto.RevokeUserSessionsResponse{Revoked: revoked}); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleClearLoginFailures(w http.ResponseWriter, r *http.Request, adminID int64, login string) {
+	if err := a.userStorage.ClearLoginFailures(r.Context(), adminID, login); err != nil {
+		writeAdminError(w, "storage.ClearLoginFailures", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleListUserAssets(w http.ResponseWriter, r *http.Request, adminID int64, login string) {
+	limit, offset, err := parsePaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	assets, err := a.userStorage.ListUserAssets(r.Context(), adminID, login, limit, offset)
+	if err != nil {
+		writeAdminError(w, "storage.ListUserAssets", err)
+		return
+	}
+
+	resp := dto.GetUserAssetsListResponse{
+		Assets: assets,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleDeleteUserAsset(w http.ResponseWriter, r *http.Request, adminID int64, login, assetName string) {
+	version, err := parseVersionParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.userStorage.DeleteUserAsset(r.Context(), adminID, login, assetName, version); err != nil {
+		writeAdminError(w, "storage.DeleteUserAsset", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleListLoginLockouts(w http.ResponseWriter, r *http.Request, adminID int64) {
+	limit, offset, err := parsePaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lockouts, err := a.userStorage.ListLoginLockouts(r.Context(), adminID, limit, offset)
+	if err != nil {
+		log.Printf("storage.ListLoginLockouts error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListLoginLockoutsResponse{
+		Lockouts: make([]dto.LoginLockout, 0, len(lockouts)),
+	}
+	for _, lockout := range lockouts {
+		resp.Lockouts = append(resp.Lockouts, dto.LoginLockout{
+			Kind:        lockout.Kind,
+			Subject:     lockout.Subject,
+			Failures:    lockout.Failures,
+			LockedUntil: lockout.LockedUntil,
+			CreatedAt:   lockout.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleListAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := a.userStorage.ListAuditLog(r.Context(), limit, offset)
+	if err != nil {
+		log.Printf("storage.ListAuditLog error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListAuditLogResponse{
+		Entries: make([]dto.AuditLogEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, dto.AuditLogEntry{
+			ID:        entry.ID,
+			Admin:     entry.AdminLogin,
+			Action:    entry.Action,
+			Target:    entry.Target,
+			Details:   entry.Details,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, operation string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrAssetNotFound):
+		http.Error(w, "Asset not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrOwnAccount):
+		http.Error(w, "Admins can't disable or demote themselves", http.StatusConflict)
+	default:
+		log.Printf("%s error: %v", operation, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func userAccountResponse(user types.UserAccount) dto.UserAccount {
+	return dto.UserAccount{
+		Login:            user.Login,
+		Admin:            user.Admin,
+		Disabled:         user.DisabledAt != nil,
+		DisabledAt:       user.DisabledAt,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		External:         user.External,
+		CreatedAt:        user.CreatedAt,
+		Assets:           user.Assets,
+		AssetVersions:    user.AssetVersions,
+		StorageBytes:     user.StorageBytes,
+		ActiveSessions:   user.ActiveSessions,
+	}
+}
@@ -2,55 +2,201 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/ArturV19/file-storage/config"
+	"github.com/ArturV19/file-storage/internal/notify"
+	"github.com/ArturV19/file-storage/internal/oidc"
+	"github.com/ArturV19/file-storage/internal/token"
 	"github.com/ArturV19/file-storage/internal/types"
+	"github.com/ArturV19/file-storage/internal/validation"
 )
 
 type assetStorage interface {
-	UploadAsset(ctx context.Context, uploadAssetData types.UploadAssetData) error
-	GetAsset(ctx context.Context, userID int64, assetName string) ([]byte, string, string, error)
-	DeleteAsset(ctx context.Context, userID int64, assetName string) error
+	UploadAsset(ctx context.Context, uploadAssetData types.UploadAssetData) (types.Asset, error)
+	GetAsset(ctx context.Context, userID int64, assetName string, version int) (*types.AssetContent, error)
+	DeleteAsset(ctx context.Context, userID int64, assetName string, version int, precondition types.AssetPrecondition) error
 	GetUserAssetsList(ctx context.Context, userID int64, limit, offset int) ([]types.Asset, error)
+	ListAssetVersions(ctx context.Context, userID int64, assetName string) ([]types.AssetVersion, error)
+	RestoreAssetVersion(ctx context.Context, userID int64, assetName string, version int) (types.Asset, error)
+	CreateUpload(ctx context.Context, upload types.Upload) (types.Upload, error)
+	GetUpload(ctx context.Context, userID int64, uploadID string) (types.Upload, error)
+	GetUploadAssetName(ctx context.Context, uploadID string) (string, error)
+	WriteUploadChunk(ctx context.Context, userID int64, uploadID string, offset int64, body io.Reader) (types.Upload, error)
+	DeleteUpload(ctx context.Context, userID int64, uploadID string) error
+	CreateMultipartUpload(ctx context.Context, upload types.MultipartUpload) (types.MultipartUpload, error)
+	UploadPart(ctx context.Context, userID int64, assetName, uploadID string, partNumber int, body io.Reader, maxSize int64) (types.UploadPart, error)
+	ListUploadParts(ctx context.Context, userID int64, assetName, uploadID string) ([]types.UploadPart, error)
+	CompleteMultipartUpload(ctx context.Context, userID int64, assetName, uploadID string, parts []types.UploadPart, maxSize int64) error
+	AbortMultipartUpload(ctx context.Context, userID int64, assetName, uploadID string) error
+	CreateShareLink(ctx context.Context, link types.ShareLink, password string) (types.ShareLink, error)
+	ListShareLinks(ctx context.Context, userID int64) ([]types.ShareLink, error)
+	DeleteShareLink(ctx context.Context, userID int64, linkID string) error
+	OpenSharedAsset(ctx context.Context, linkID, password, ipAddress string) (types.ShareLink, *types.AssetContent, error)
+	CountShareLinkDownload(ctx context.Context, linkID string) error
+	CreateGrant(ctx context.Context, grant types.AssetGrant) (types.AssetGrant, error)
+	ListGrants(ctx context.Context, ownerID int64) ([]types.AssetGrant, error)
+	DeleteGrant(ctx context.Context, ownerID, grantID int64) error
+	ResolveAssetOwner(ctx context.Context, userID int64, ownerLogin, assetName string, write bool) (int64, error)
+	GetSharedAssetsList(ctx context.Context, userID int64, limit, offset int) ([]types.Asset, error)
+	CreateOrganization(ctx context.Context, userID int64, name string) (types.Organization, error)
+	ListOrganizations(ctx context.Context, userID int64) ([]types.Organization, error)
+	ListOrganizationMembers(ctx context.Context, userID int64, orgName string) ([]types.OrganizationMember, error)
+	SetOrganizationMember(ctx context.Context, userID int64, orgName, login, role string) error
+	RemoveOrganizationMember(ctx context.Context, userID int64, orgName, login string) error
+	ResolveOrganizationNamespace(ctx context.Context, userID int64, orgName string, write bool) (int64, error)
+	GetOrganizationAssetsList(ctx context.Context, orgID int64, limit, offset int) ([]types.Asset, error)
 }
 
 type userStorage interface {
 	CreateUser(ctx context.Context, login, password string) (int64, error)
-	ValidateToken(ctx context.Context, token string) (int64, error)
-	NewSession(ctx context.Context, authData types.AuthData) (string, error)
+	ValidateToken(ctx context.Context, token string) (int64, string, error)
+	NewSession(ctx context.Context, authData types.AuthData) (types.SessionTokens, error)
+	RefreshSession(ctx context.Context, refreshToken string) (types.SessionTokens, error)
+	CreateAPIKey(ctx context.Context, apiKey types.APIKey) (types.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]types.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID int64, keyID string) error
+	ValidateAPIKey(ctx context.Context, key string) (int64, []string, error)
+	ListSessions(ctx context.Context, userID int64, currentSessionID string) ([]types.Session, error)
+	DeleteSession(ctx context.Context, userID int64, sessionID string) error
+	DeleteOtherSessions(ctx context.Context, userID int64, currentSessionID string) error
+	Logout(ctx context.Context, sessionID string) error
+	ListRevokedSessions(ctx context.Context) ([]string, error)
+	CompleteTwoFactorLogin(ctx context.Context, challengeToken, code string, authData types.AuthData) (types.SessionTokens, error)
+	EnrollTOTP(ctx context.Context, userID int64) (string, string, error)
+	ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID int64, password, code, ipAddress string) error
+	CreateOIDCLoginState(ctx context.Context, state types.OIDCLoginState) error
+	ConsumeOIDCLoginState(ctx context.Context, state string) (types.OIDCLoginState, error)
+	NewExternalSession(ctx context.Context, identity types.ExternalIdentity, authData types.AuthData) (types.SessionTokens, error)
+	ResolveExternalUser(ctx context.Context, issuer, claim, value string, localLogin bool) (int64, error)
+	GetUserLogin(ctx context.Context, userID int64) (string, error)
+	CheckUserActive(ctx context.Context, userID int64) error
+	ChangePassword(ctx context.Context, userID int64, currentSessionID, currentPassword, newPassword, ipAddress string) error
+	CreatePasswordResetToken(ctx context.Context, login, ipAddress string) (string, time.Time, error)
+	GetPasswordResetLogin(ctx context.Context, token string) (string, error)
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	DeleteAccount(ctx context.Context, userID int64, password, ipAddress string) error
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	ListUsers(ctx context.Context, adminID int64, search string, limit, offset int) ([]types.UserAccount, error)
+	GetUserAccount(ctx context.Context, adminID int64, login string) (types.UserAccount, error)
+	UpdateUser(ctx context.Context, adminID int64, login string, admin, disabled *bool) error
+	RevokeUserSessions(ctx context.Context, adminID int64, login string) (int64, error)
+	ClearLoginFailures(ctx context.Context, adminID int64, login string) error
+	ListUserAssets(ctx context.Context, adminID int64, login string, limit, offset int) ([]types.Asset, error)
+	DeleteUserAsset(ctx context.Context, adminID int64, login, assetName string, version int) error
+	ListLoginLockouts(ctx context.Context, adminID int64, limit, offset int) ([]types.LoginLockout, error)
+	ListAuditLog(ctx context.Context, limit, offset int) ([]types.AuditLogEntry, error)
 }
 
 type API struct {
-	httpServer   *http.Server
-	assetStorage assetStorage
-	userStorage  userStorage
+	httpServer    *http.Server
+	assetStorage  assetStorage
+	userStorage   userStorage
+	notifier      notify.Notifier
+	accountPolicy *validation.Policy
+	urlSigningKey []byte
+
+	// tokenSigner is set in the signed token mode.
+	tokenSigner     *token.Signer
+	revokedSessions revokedSessions
+
+	// oidcProvider is set when login through an identity provider is
+	// configured.
+	oidcProvider *oidc.Provider
+	// externalTokens is set when access tokens of the identity provider are
+	// accepted.
+	externalTokens *externalTokens
 }
 
-func New(httpCfg config.HTTPConfig, assetStorage assetStorage, userStorage userStorage) (newAPI *API) {
+func New(httpCfg config.HTTPConfig, authCfg config.AuthConfig, assetStorage assetStorage, userStorage userStorage, notifier notify.Notifier) (newAPI *API, err error) {
 	newAPI = &API{
-		assetStorage: assetStorage,
-		userStorage:  userStorage,
+		assetStorage:  assetStorage,
+		userStorage:   userStorage,
+		notifier:      notifier,
+		urlSigningKey: []byte(authCfg.URLSigningKey),
+	}
+
+	if len(newAPI.urlSigningKey) == 0 {
+		log.Println("URL signing key is not set, presigned URLs won't survive a restart")
+		newAPI.urlSigningKey = make([]byte, 32)
+		if _, err := rand.Read(newAPI.urlSigningKey); err != nil {
+			return nil, err
+		}
+	}
+
+	newAPI.accountPolicy, err = validation.NewPolicy(authCfg.AccountPolicy)
+	if err != nil {
+		return nil, err
 	}
 
+	newAPI.tokenSigner, err = newTokenSigner(authCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	newAPI.oidcProvider = newOIDCProvider(authCfg.OIDC)
+	newAPI.externalTokens = newExternalTokens(authCfg.ExternalTokens)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/users/create", newAPI.createUserHandler)
 	mux.HandleFunc("/api/auth", newAPI.authenticateUserHandler)
+	mux.HandleFunc("/api/auth/refresh", newAPI.refreshSessionHandler)
+	mux.HandleFunc(twoFactorLoginPath, newAPI.twoFactorLoginHandler)
+	mux.HandleFunc(twoFactorPathPrefix, newAPI.twoFactorHandler)
+	if newAPI.oidcProvider != nil {
+		mux.HandleFunc(oidcLoginPath, newAPI.oidcLoginHandler)
+		mux.HandleFunc(oidcCallbackPath, newAPI.oidcCallbackHandler)
+	}
+	mux.HandleFunc(accountPath, newAPI.accountHandler)
+	mux.HandleFunc(accountPasswordPath, newAPI.changePasswordHandler)
+	if newAPI.notifier != nil {
+		mux.HandleFunc(passwordResetPath, newAPI.passwordResetHandler)
+		mux.HandleFunc(passwordResetConfirmPath, newAPI.confirmPasswordResetHandler)
+	}
+	mux.HandleFunc(logoutPath, newAPI.logoutHandler)
+	mux.HandleFunc(sessionsPath, newAPI.sessionsHandler)
+	mux.HandleFunc(sessionsPath+"/", newAPI.sessionsHandler)
 	mux.HandleFunc("/api/upload-asset/", newAPI.UploadAssetHandler)
 	mux.HandleFunc("/api/asset/", newAPI.assetHandler)
+	mux.HandleFunc(assetVersionsPathPrefix, newAPI.assetVersionsHandler)
 	mux.HandleFunc("/api/list-assets", newAPI.getUserAssetsListHandler)
+	mux.HandleFunc("/api/presign", newAPI.presignHandler)
+	mux.HandleFunc(shareLinksPath, newAPI.shareLinksHandler)
+	mux.HandleFunc(shareLinksPath+"/", newAPI.shareLinksHandler)
+	mux.HandleFunc(publicPathPrefix, newAPI.publicAssetHandler)
+	mux.HandleFunc(grantsPath, newAPI.grantsHandler)
+	mux.HandleFunc(grantsPath+"/", newAPI.grantsHandler)
+	mux.HandleFunc(sharedAssetsPath, newAPI.sharedAssetsHandler)
+	mux.HandleFunc(orgsPath, newAPI.orgsHandler)
+	mux.HandleFunc(orgsPath+"/", newAPI.orgsHandler)
+	mux.HandleFunc(apiKeysPath, newAPI.apiKeysHandler)
+	mux.HandleFunc(apiKeysPath+"/", newAPI.apiKeysHandler)
+	mux.HandleFunc(tusPathPrefix, newAPI.tusHandler)
+	mux.HandleFunc(multipartUploadPathPrefix, newAPI.multipartUploadHandler)
+	mux.HandleFunc(adminPathPrefix, newAPI.adminHandler)
 
 	newAPI.httpServer = &http.Server{
 		Addr:    net.JoinHostPort(httpCfg.Host, httpCfg.Port),
 		Handler: mux,
 	}
 
-	return newAPI
+	return newAPI, nil
 }
 
 func (a *API) Start(ctx context.Context) error {
+	if a.tokenSigner != nil {
+		if err := a.reloadRevokedSessions(ctx); err != nil {
+			return err
+		}
+		go a.keepRevokedSessionsFresh(ctx)
+	}
+
 	httpServeEndSig := make(chan struct{})
 	go func() {
 		log.Printf("Starting HTTP server on %s\n", a.httpServer.Addr)
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// API keys are long-lived bearer tokens for automation, limited to scopes:
+//
+//	POST   /api/api-keys        {"name": "ci", "scopes": ["assets:read"]}, returns the key once
+//	GET    /api/api-keys        list own keys with their last use
+//	DELETE /api/api-keys/{id}   revoke a key
+//
+// Keys are managed with session tokens only.
+const apiKeysPath = "/api/api-keys"
+
+var apiKeyScopes = map[string]bool{
+	types.ScopeAssetsRead:   true,
+	types.ScopeAssetsWrite:  true,
+	types.ScopeAssetsDelete: true,
+}
+
+func (a *API) apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+	userID := auth.userID
+
+	keyID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, apiKeysPath), "/")
+	if keyID != "" {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleDeleteAPIKey(w, r, userID, keyID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		a.handleCreateAPIKey(w, r, userID)
+	case http.MethodGet:
+		a.handleListAPIKeys(w, r, userID)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleCreateAPIKey(w http.ResponseWriter, r *http.Request, userID int64) {
+	var req dto.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is empty", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		http.Error(w, "Scopes are empty", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !apiKeyScopes[scope] {
+			http.Error(w, "Invalid scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	apiKey, key, err := a.userStorage.CreateAPIKey(r.Context(), types.APIKey{
+		UserID: userID,
+		Name:   req.Name,
+		Scopes: req.Scopes,
+	})
+	if err != nil {
+		log.Printf("storage.CreateAPIKey error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := apiKeyResponse(apiKey)
+	resp.Key = key
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) handleListAPIKeys(w http.ResponseWriter, r *http.Request, userID int64) {
+	apiKeys, err := a.userStorage.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		log.Printf("storage.ListAPIKeys error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListAPIKeysResponse{
+		APIKeys: make([]dto.APIKey, 0, len(apiKeys)),
+	}
+	for _, apiKey := range apiKeys {
+		resp.APIKeys = append(resp.APIKeys, apiKeyResponse(apiKey))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request, userID int64, keyID string) {
+	err := a.userStorage.DeleteAPIKey(r.Context(), userID, keyID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+		} else {
+			log.Printf("storage.DeleteAPIKey error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiKeyResponse(apiKey types.APIKey) dto.APIKey {
+	return dto.APIKey{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Scopes:     apiKey.Scopes,
+		CreatedAt:  apiKey.CreatedAt,
+		LastUsedAt: apiKey.LastUsedAt,
+	}
+}
@@ -6,18 +6,21 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/ArturV19/file-storage/internal/dto"
 	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
 )
 
 func (a *API) assetHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := a.authorize(r)
+	auth, err := a.authorize(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	userID := auth.userID
 
 	assetName := strings.TrimPrefix(r.URL.Path, "/api/asset/")
 	if assetName == "" {
@@ -25,39 +28,83 @@ func (a *API) assetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, err := parseVersionParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scope := types.ScopeAssetsRead
+	if r.Method == http.MethodDelete {
+		scope = types.ScopeAssetsDelete
+	}
+	if !requireScope(w, auth, scope) {
+		return
+	}
+
+	namespaceID, ok := a.resolveNamespace(w, r, userID, assetName, r.Method == http.MethodDelete)
+	if !ok {
+		return
+	}
+
 	switch r.Method {
-	case http.MethodGet:
-		a.handleGetAsset(w, r, userID, assetName)
+	case http.MethodGet, http.MethodHead:
+		a.handleGetAsset(w, r, namespaceID, assetName, version)
 	case http.MethodDelete:
-		a.handleDeleteAsset(w, r, userID, assetName)
+		a.handleDeleteAsset(w, r, namespaceID, assetName, version)
 	default:
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func (a *API) handleGetAsset(w http.ResponseWriter, r *http.Request, userID int64, assetName string) {
-	data, originalName, contentType, err := a.assetStorage.GetAsset(r.Context(), userID, assetName)
+func (a *API) handleGetAsset(w http.ResponseWriter, r *http.Request, userID int64, assetName string, version int) {
+	content, err := a.assetStorage.GetAsset(r.Context(), userID, assetName, version)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": fmt.Sprintf("Asset not found: %s", assetName),
-		})
+		if errors.Is(err, storage.ErrAssetNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Asset not found: %s", assetName),
+			})
+		} else {
+			log.Printf("storage.GetAsset error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Internal server error",
+			})
+		}
 		return
 	}
 
-	w.Header().Set("Content-Type", contentType)
-	if originalName != "" {
-		w.Header().Set("Content-Disposition", "attachment; filename=\""+originalName+"\"")
+	serveAsset(w, r, assetName, content)
+}
+
+// serveAsset streams the asset content to the client and closes it. It is the
+// common download path for every way of accessing an asset.
+func serveAsset(w http.ResponseWriter, r *http.Request, assetName string, content *types.AssetContent) {
+	defer func() {
+		if err := content.Body.Close(); err != nil {
+			log.Printf("Error closing asset body: %v", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", content.ContentType)
+	w.Header().Set("X-Asset-Version", strconv.Itoa(content.Version))
+	if content.ETag != "" {
+		w.Header().Set("ETag", formatETag(content.ETag))
 	}
-	_, err = w.Write(data)
-	if err != nil {
-		log.Printf("Error writing response: %v", err)
+	if content.OriginalName != "" {
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+content.OriginalName+"\"")
 	}
+
+	// ServeContent streams the body and takes care of Range, If-Range,
+	// Accept-Ranges and 206 Partial Content responses as well as If-Match
+	// and If-None-Match (304 Not Modified) against the ETag set above.
+	http.ServeContent(w, r, assetName, content.CreatedAt, content.Body)
 }
 
-func (a *API) handleDeleteAsset(w http.ResponseWriter, r *http.Request, userID int64, assetName string) {
-	err := a.assetStorage.DeleteAsset(r.Context(), userID, assetName)
+func (a *API) handleDeleteAsset(w http.ResponseWriter, r *http.Request, userID int64, assetName string, version int) {
+	err := a.assetStorage.DeleteAsset(r.Context(), userID, assetName, version, assetPrecondition(r))
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
 		if errors.Is(err, storage.ErrAssetNotFound) {
@@ -65,6 +112,11 @@ func (a *API) handleDeleteAsset(w http.ResponseWriter, r *http.Request, userID i
 			json.NewEncoder(w).Encode(map[string]string{
 				"error": fmt.Sprintf("Asset not found: %s", assetName),
 			})
+		} else if errors.Is(err, errPreconditionFailed) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Precondition failed",
+			})
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{
@@ -84,3 +136,19 @@ func (a *API) handleDeleteAsset(w http.ResponseWriter, r *http.Request, userID i
 		})
 	}
 }
+
+// parseVersionParam returns the asset version requested with ?version=, or 0
+// for the latest version.
+func parseVersionParam(r *http.Request) (int, error) {
+	versionStr := r.URL.Query().Get("version")
+	if versionStr == "" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(versionStr)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+
+	return version, nil
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// GET  /api/asset-versions/{name}             lists the versions of an asset
+// POST /api/asset-versions/{name}?version=N   makes a copy of version N the latest one
+const assetVersionsPathPrefix = "/api/asset-versions/"
+
+func (a *API) assetVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	userID := auth.userID
+
+	assetName := strings.TrimPrefix(r.URL.Path, assetVersionsPathPrefix)
+	if assetName == "" {
+		http.Error(w, "Name is empty", http.StatusBadRequest)
+		return
+	}
+
+	scope := types.ScopeAssetsRead
+	if r.Method == http.MethodPost {
+		scope = types.ScopeAssetsWrite
+	}
+	if !requireScope(w, auth, scope) {
+		return
+	}
+
+	namespaceID, ok := a.resolveNamespace(w, r, userID, assetName, r.Method == http.MethodPost)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.handleListAssetVersions(w, r, namespaceID, assetName)
+	case http.MethodPost:
+		a.handleRestoreAssetVersion(w, r, namespaceID, assetName)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleListAssetVersions(w http.ResponseWriter, r *http.Request, userID int64, assetName string) {
+	versions, err := a.assetStorage.ListAssetVersions(r.Context(), userID, assetName)
+	if err != nil {
+		writeAssetVersionError(w, "storage.ListAssetVersions", assetName, err)
+		return
+	}
+
+	resp := dto.GetAssetVersionsResponse{
+		Name:     assetName,
+		Versions: versions,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleRestoreAssetVersion(w http.ResponseWriter, r *http.Request, userID int64, assetName string) {
+	version, err := parseVersionParam(r)
+	if err != nil || version == 0 {
+		http.Error(w, "invalid version parameter", http.StatusBadRequest)
+		return
+	}
+
+	asset, err := a.assetStorage.RestoreAssetVersion(r.Context(), userID, assetName, version)
+	if err != nil {
+		writeAssetVersionError(w, "storage.RestoreAssetVersion", assetName, err)
+		return
+	}
+
+	resp := dto.RestoreAssetVersionResponse{
+		Status:  "ok",
+		Version: asset.Version,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeAssetVersionError(w http.ResponseWriter, operation, assetName string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case errors.Is(err, storage.ErrAssetNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Asset not found: %s", assetName),
+		})
+	case errors.Is(err, storage.ErrVersioningDisabled):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Versioning is disabled",
+		})
+	default:
+		log.Printf("%s error: %v", operation, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal server error",
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/types"
 )
 
 const (
@@ -15,11 +16,15 @@ const (
 )
 
 func (a *API) getUserAssetsListHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := a.authorize(r)
+	auth, err := a.authorize(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	if !requireScope(w, auth, types.ScopeAssetsRead) {
+		return
+	}
+	userID := auth.userID
 
 	limit, offset, err := parsePaginationParams(r)
 	if err != nil {
@@ -31,7 +36,16 @@ func (a *API) getUserAssetsListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files, err := a.assetStorage.GetUserAssetsList(r.Context(), userID, limit, offset)
+	var files []types.Asset
+	if orgName := r.URL.Query().Get(orgParam); orgName != "" {
+		orgID, ok := a.resolveOrganization(w, r, userID, orgName, false)
+		if !ok {
+			return
+		}
+		files, err = a.assetStorage.GetOrganizationAssetsList(r.Context(), orgID, limit, offset)
+	} else {
+		files, err = a.assetStorage.GetUserAssetsList(r.Context(), userID, limit, offset)
+	}
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -3,9 +3,13 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"log"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ArturV19/file-storage/internal/dto"
 	"github.com/ArturV19/file-storage/internal/storage"
@@ -32,7 +36,6 @@ func (a *API) authenticateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Password = strings.TrimSpace(req.Password)
 	if req.Password == "" {
 		http.Error(w, "Empty password", http.StatusBadRequest)
 		return
@@ -48,20 +51,87 @@ func (a *API) authenticateUserHandler(w http.ResponseWriter, r *http.Request) {
 		Login:     req.Login,
 		Password:  req.Password,
 		IPAddress: ipAddress,
+		UserAgent: r.UserAgent(),
 	}
 
-	token, err := a.userStorage.NewSession(ctx, authData)
+	tokens, err := a.userStorage.NewSession(ctx, authData)
 	if err != nil {
+		var throttled *storage.LoginThrottledError
+		var twoFactorRequired *storage.TwoFactorRequiredError
 		if errors.Is(err, storage.ErrInvalidLoginPassword) {
 			http.Error(w, "Invalid login/password", http.StatusUnauthorized)
+		} else if errors.Is(err, storage.ErrAccountDisabled) {
+			http.Error(w, "Account disabled", http.StatusForbidden)
+		} else if errors.As(err, &throttled) {
+			writeLoginThrottled(w, throttled)
+		} else if errors.As(err, &twoFactorRequired) {
+			writeTwoFactorRequired(w, twoFactorRequired.ChallengeToken)
 		} else {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
 
+	a.writeSessionTokens(w, tokens)
+}
+
+// refreshSessionHandler trades a refresh token for a new token pair.
+func (a *API) refreshSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req dto.RefreshSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "Empty refresh token", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := a.userStorage.RefreshSession(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidToken) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		} else if errors.Is(err, storage.ErrRefreshTokenReused) {
+			http.Error(w, "Refresh token reused, session revoked", http.StatusUnauthorized)
+		} else {
+			log.Printf("storage.RefreshSession error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	a.writeSessionTokens(w, tokens)
+}
+
+// writeLoginThrottled tells the client when to try logging in again.
+func writeLoginThrottled(w http.ResponseWriter, throttled *storage.LoginThrottledError) {
+	writeTooManyRequests(w, throttled, "Too many failed login attempts")
+}
+
+func writeTooManyRequests(w http.ResponseWriter, throttled *storage.LoginThrottledError, message string) {
+	retryAfter := int64(math.Ceil(throttled.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(max(retryAfter, 1), 10))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+func (a *API) writeSessionTokens(w http.ResponseWriter, tokens types.SessionTokens) {
+	tokens, err := a.signSessionTokens(tokens)
+	if err != nil {
+		log.Printf("Error signing access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	resp := dto.AuthenticateUserResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(time.Until(tokens.ExpiresAt).Round(time.Second) / time.Second),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
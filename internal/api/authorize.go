@@ -2,25 +2,163 @@ package api
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"strings"
+
+	"github.com/ArturV19/file-storage/internal/oidc"
+	"github.com/ArturV19/file-storage/internal/storage"
+	tokens "github.com/ArturV19/file-storage/internal/token"
 )
 
-func (a *API) authorize(r *http.Request) (int64, error) {
+// authContext describes who a request is authorized as and how.
+type authContext struct {
+	userID int64
+	// presigned holds the constraints of the presigned URL the request was
+	// authorized with, if any.
+	presigned *presignedURL
+	// apiKey is set if the request was authorized with an API key.
+	apiKey bool
+	// external is set if the request was authorized with an access token of
+	// the identity provider.
+	external bool
+	// scopes limit API keys and access tokens, nil means unlimited.
+	scopes []string
+	// sessionID is the public ID of the session the request was authorized
+	// with, empty for other kinds of authorization.
+	sessionID string
+}
+
+// hasScope reports whether the request may perform operations of the scope.
+// Session tokens and presigned URLs are not limited by scopes.
+func (c *authContext) hasScope(scope string) bool {
+	if c.scopes == nil {
+		return true
+	}
+	for _, s := range c.scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// requireScope writes a 403 response and returns false if the request lacks
+// the scope.
+func requireScope(w http.ResponseWriter, auth *authContext, scope string) bool {
+	if !auth.hasScope(scope) {
+		http.Error(w, "Token lacks scope "+scope, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireSession writes a 403 response and returns false unless the request
+// was authorized with a session token. Account management is not available
+// to API keys and access tokens of the identity provider.
+func requireSession(w http.ResponseWriter, auth *authContext) bool {
+	if auth.apiKey || auth.external || auth.presigned != nil {
+		http.Error(w, "Session token required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (a *API) authorize(r *http.Request) (*authContext, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return 0, errors.New("missing authorization header")
+		if r.URL.Query().Get(presignSignatureParam) != "" {
+			presigned, err := a.verifyPresignedURL(r)
+			if err != nil {
+				return nil, err
+			}
+			return &authContext{userID: presigned.userID, presigned: presigned}, nil
+		}
+		return nil, errors.New("missing authorization header")
 	}
 
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 	if token == "" {
-		return 0, errors.New("missing token")
+		return nil, errors.New("missing token")
+	}
+
+	if strings.HasPrefix(token, storage.APIKeyPrefix) {
+		userID, scopes, err := a.userStorage.ValidateAPIKey(r.Context(), token)
+		if err != nil {
+			return nil, errors.New("invalid token")
+		}
+		return &authContext{userID: userID, apiKey: true, scopes: scopes}, nil
+	}
+
+	if a.isExternalToken(token) {
+		auth, err := a.verifyExternalToken(r.Context(), token)
+		if err != nil {
+			if !errors.Is(err, oidc.ErrInvalidToken) && !errors.Is(err, oidc.ErrExpiredToken) && !errors.Is(err, storage.ErrUserNotFound) {
+				log.Printf("Error verifying external access token: %v", err)
+			}
+			return nil, errors.New("invalid token")
+		}
+		return auth, nil
 	}
 
-	userID, err := a.userStorage.ValidateToken(r.Context(), token)
+	if a.tokenSigner != nil && tokens.LooksLikeToken(token) {
+		auth, err := a.verifySignedToken(token)
+		if err != nil {
+			return nil, errors.New("invalid token")
+		}
+		return auth, nil
+	}
+
+	userID, sessionID, err := a.userStorage.ValidateToken(r.Context(), token)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+
+	return &authContext{userID: userID, sessionID: sessionID}, nil
+}
+
+// resolveNamespace returns the uid of the namespace a request accesses the
+// asset in: the organization named by the org query parameter, the user whose
+// login is in the owner query parameter, or the caller's own namespace. Write
+// access needs the editor or owner role in an organization and a read-write
+// grant from another user. It writes the error response and returns false if
+// the caller has no such access.
+func (a *API) resolveNamespace(w http.ResponseWriter, r *http.Request, userID int64, assetName string, write bool) (int64, bool) {
+	query := r.URL.Query()
+	if orgName := query.Get(orgParam); orgName != "" {
+		if query.Get(ownerParam) != "" {
+			http.Error(w, "org and owner parameters are mutually exclusive", http.StatusBadRequest)
+			return 0, false
+		}
+		return a.resolveOrganization(w, r, userID, orgName, write)
+	}
+
+	namespaceID, err := a.assetStorage.ResolveAssetOwner(r.Context(), userID, query.Get(ownerParam), assetName, write)
 	if err != nil {
-		return 0, errors.New("invalid token")
+		writeNamespaceError(w, "storage.ResolveAssetOwner", err)
+		return 0, false
 	}
 
-	return userID, nil
+	return namespaceID, true
+}
+
+// resolveOrganization returns the namespace of the organization if the
+// caller's role in it allows the access.
+func (a *API) resolveOrganization(w http.ResponseWriter, r *http.Request, userID int64, orgName string, write bool) (int64, bool) {
+	namespaceID, err := a.assetStorage.ResolveOrganizationNamespace(r.Context(), userID, orgName, write)
+	if err != nil {
+		writeNamespaceError(w, "storage.ResolveOrganizationNamespace", err)
+		return 0, false
+	}
+
+	return namespaceID, true
+}
+
+func writeNamespaceError(w http.ResponseWriter, operation string, err error) {
+	if errors.Is(err, storage.ErrAccessDenied) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+	} else {
+		log.Printf("%s error: %v", operation, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
 }
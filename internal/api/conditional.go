@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+var errPreconditionFailed = errors.New("precondition failed")
+
+// assetPrecondition turns the If-Match and If-None-Match headers of a write
+// request into a check run by the storage while the asset is locked, so the
+// check and the write can't race with other writers. It returns nil if the
+// request has no conditional headers.
+func assetPrecondition(r *http.Request) types.AssetPrecondition {
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+
+	return func(current *types.Asset) error {
+		if ifMatch != "" {
+			if current == nil || !etagListMatches(ifMatch, current.ETag, false) {
+				return errPreconditionFailed
+			}
+		}
+
+		if ifNoneMatch != "" && current != nil {
+			if etagListMatches(ifNoneMatch, current.ETag, true) {
+				return errPreconditionFailed
+			}
+		}
+
+		return nil
+	}
+}
+
+// etagListMatches reports whether a list of entity tags from a conditional
+// header matches the current ETag. "*" matches any existing representation.
+// Weak tags only match when weak comparison is allowed.
+func etagListMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == formatETag(etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatETag(etag string) string {
+	return `"` + etag + `"`
+}
@@ -25,15 +25,11 @@ func (a *API) createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Logins are trimmed, passwords are taken as they are.
 	req.Login = strings.TrimSpace(req.Login)
-	if req.Login == "" {
-		http.Error(w, "Empty login", http.StatusBadRequest)
-		return
-	}
-
-	req.Password = strings.TrimSpace(req.Password)
-	if req.Password == "" {
-		http.Error(w, "Empty password", http.StatusBadRequest)
+	errs := a.accountPolicy.ValidateLogin(req.Login)
+	errs = append(errs, a.accountPolicy.ValidatePassword(req.Login, req.Password)...)
+	if !writeValidationErrors(w, errs) {
 		return
 	}
 
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ArturV19/file-storage/config"
+	"github.com/ArturV19/file-storage/internal/oidc"
+)
+
+// Services holding access tokens from the identity provider call the asset
+// API with them directly. Like API keys they are limited to the assets:*
+// scopes in their scope claim and can't manage the account.
+type externalTokens struct {
+	verifier  *oidc.Verifier
+	userClaim string
+	// userLogins are the local users the user claim may name besides users
+	// provisioned from the provider.
+	userLogins map[string]bool
+}
+
+func newExternalTokens(cfg config.ExternalTokenConfig) *externalTokens {
+	if !cfg.Enabled() {
+		return nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	keys := oidc.NewIssuerKeySet(cfg.Issuer, client)
+	if cfg.JWKSURL != "" {
+		keys = oidc.NewKeySet(cfg.JWKSURL, client)
+	}
+
+	userLogins := make(map[string]bool, len(cfg.UserLogins))
+	for _, login := range cfg.UserLogins {
+		userLogins[login] = true
+	}
+
+	return &externalTokens{
+		verifier: &oidc.Verifier{
+			Issuer:   cfg.Issuer,
+			Audience: cfg.Audience,
+			Keys:     keys,
+		},
+		userClaim:  cfg.UserClaim,
+		userLogins: userLogins,
+	}
+}
+
+// isExternalToken tells access tokens of the identity provider apart from
+// signed access tokens issued here.
+func (a *API) isExternalToken(accessToken string) bool {
+	return a.externalTokens != nil && oidc.UnverifiedIssuer(accessToken) == a.externalTokens.verifier.Issuer
+}
+
+// verifyExternalToken authorizes a request with an access token of the
+// identity provider.
+func (a *API) verifyExternalToken(ctx context.Context, accessToken string) (*authContext, error) {
+	claims, err := a.externalTokens.verifier.Verify(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := claims.Raw[a.externalTokens.userClaim].(string)
+	if !ok || value == "" {
+		return nil, errors.New("token lacks user claim " + a.externalTokens.userClaim)
+	}
+
+	userID, err := a.userStorage.ResolveExternalUser(ctx, claims.Issuer, a.externalTokens.userClaim, value, a.externalTokens.userLogins[value])
+	if err != nil {
+		return nil, err
+	}
+
+	return &authContext{userID: userID, external: true, scopes: claims.Scopes()}, nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ArturV19/file-storage/config"
+	"github.com/ArturV19/file-storage/internal/oidc/oidctest"
+	"github.com/ArturV19/file-storage/internal/storage"
+)
+
+// externalUserStorage resolves the users of external access tokens from
+// fixed maps of claim values like ResolveExternalUser: provisioned users are
+// always found, other local users only with localLogin.
+type externalUserStorage struct {
+	userStorage
+
+	provisioned map[string]int64
+	local       map[string]int64
+	issuers     []string
+}
+
+func (s *externalUserStorage) ResolveExternalUser(ctx context.Context, issuer, claim, value string, localLogin bool) (int64, error) {
+	s.issuers = append(s.issuers, issuer)
+	if userID, ok := s.provisioned[value]; ok {
+		return userID, nil
+	}
+	if userID, ok := s.local[value]; ok && localLogin {
+		return userID, nil
+	}
+	return 0, storage.ErrUserNotFound
+}
+
+// ValidateToken rejects the tokens that aren't taken for external tokens.
+func (s *externalUserStorage) ValidateToken(ctx context.Context, token string) (int64, string, error) {
+	return 0, "", storage.ErrInvalidToken
+}
+
+// newExternalTokenTestAPI returns an API accepting the access tokens of a
+// mock identity provider, the provider and its issuer.
+func newExternalTokenTestAPI(t *testing.T, issuerSuffix string, users *externalUserStorage, cfg config.ExternalTokenConfig) (*API, *oidctest.Provider, string) {
+	t.Helper()
+
+	issuer, idp := startMockIdP(t, issuerSuffix, oidctest.Config{Audience: "file-storage-api"})
+	cfg.Issuer = issuer
+	cfg.Audience = "file-storage-api"
+	a := &API{
+		userStorage:    users,
+		externalTokens: newExternalTokens(cfg),
+	}
+	return a, idp, issuer
+}
+
+func authorizeWith(a *API, accessToken string) (*authContext, error) {
+	r := httptest.NewRequest(http.MethodGet, "/api/assets", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	return a.authorize(r)
+}
+
+func signAccessToken(t *testing.T, idp *oidctest.Provider, issuer, subject string) string {
+	t.Helper()
+
+	now := time.Now()
+	accessToken, err := idp.Sign(map[string]interface{}{
+		"iss":       issuer,
+		"sub":       subject,
+		"client_id": subject,
+		"aud":       "file-storage-api",
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+		"scope":     "assets:read",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return accessToken
+}
+
+func TestExternalTokenWithTrailingSlashIssuer(t *testing.T) {
+	users := &externalUserStorage{provisioned: map[string]int64{"service": 7}}
+	a, idp, issuer := newExternalTokenTestAPI(t, "/", users, config.ExternalTokenConfig{UserClaim: "sub"})
+
+	auth, err := authorizeWith(a, signAccessToken(t, idp, issuer, "service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.userID != 7 || !auth.external {
+		t.Fatalf("authorized as %+v, want external user 7", auth)
+	}
+	if len(users.issuers) != 1 || users.issuers[0] != issuer {
+		t.Fatalf("resolved users of %v, want %s", users.issuers, issuer)
+	}
+
+	// The issuer has to match exactly.
+	trimmed := issuer[:len(issuer)-1]
+	if _, err := authorizeWith(a, signAccessToken(t, idp, trimmed, "service")); err == nil {
+		t.Fatalf("token of issuer %s accepted", trimmed)
+	}
+}
+
+func TestExternalTokenClaimMatchesProvisionedUsers(t *testing.T) {
+	users := &externalUserStorage{
+		provisioned: map[string]int64{"alice": 1},
+		local:       map[string]int64{"bob": 2},
+	}
+	a, idp, issuer := newExternalTokenTestAPI(t, "", users, config.ExternalTokenConfig{UserClaim: "client_id"})
+
+	auth, err := authorizeWith(a, signAccessToken(t, idp, issuer, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.userID != 1 {
+		t.Fatalf("authorized as user %d, want 1", auth.userID)
+	}
+
+	// A local user who merely has the same name can't be impersonated.
+	if _, err := authorizeWith(a, signAccessToken(t, idp, issuer, "bob")); err == nil {
+		t.Fatal("token for a local user that isn't allowed accepted")
+	}
+}
+
+func TestExternalTokenClaimMatchesAllowedLocalUsers(t *testing.T) {
+	users := &externalUserStorage{
+		provisioned: map[string]int64{"alice": 1},
+		local:       map[string]int64{"ci-bot": 2, "bob": 3},
+	}
+	a, idp, issuer := newExternalTokenTestAPI(t, "", users, config.ExternalTokenConfig{
+		UserClaim:  "client_id",
+		UserLogins: []string{"ci-bot"},
+	})
+
+	auth, err := authorizeWith(a, signAccessToken(t, idp, issuer, "ci-bot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.userID != 2 || !auth.external {
+		t.Fatalf("authorized as %+v, want external user 2", auth)
+	}
+
+	if auth, err := authorizeWith(a, signAccessToken(t, idp, issuer, "alice")); err != nil || auth.userID != 1 {
+		t.Fatalf("provisioned user: %+v, %v", auth, err)
+	}
+	if _, err := authorizeWith(a, signAccessToken(t, idp, issuer, "bob")); err == nil {
+		t.Fatal("token for a local user that isn't allowed accepted")
+	}
+}
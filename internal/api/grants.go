@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// Grants give other users access to own assets:
+//
+//	POST   /api/grants             grant read or read-write access to an asset or a prefix
+//	GET    /api/grants             list given grants
+//	DELETE /api/grants/{id}        revoke a grant
+//	GET    /api/shared-assets      list assets shared with the caller
+//
+// Shared assets are accessed through the usual asset endpoints with the
+// owner's login in the owner query parameter, see resolveNamespace.
+const (
+	grantsPath       = "/api/grants"
+	sharedAssetsPath = "/api/shared-assets"
+	ownerParam       = "owner"
+)
+
+func (a *API) grantsHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+	userID := auth.userID
+
+	grantIDStr := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, grantsPath), "/")
+	if grantIDStr != "" {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		grantID, err := strconv.ParseInt(grantIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Grant not found", http.StatusNotFound)
+			return
+		}
+		a.handleDeleteGrant(w, r, userID, grantID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		a.handleCreateGrant(w, r, userID)
+	case http.MethodGet:
+		a.handleListGrants(w, r, userID)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleCreateGrant(w http.ResponseWriter, r *http.Request, userID int64) {
+	var req dto.CreateGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Grantee == "" {
+		http.Error(w, "Grantee is empty", http.StatusBadRequest)
+		return
+	}
+
+	// An empty prefix would silently cover every present and future asset.
+	if req.AssetName == "" {
+		http.Error(w, "Name is empty", http.StatusBadRequest)
+		return
+	}
+
+	if req.Permission != types.PermissionRead && req.Permission != types.PermissionReadWrite {
+		http.Error(w, "Invalid permission", http.StatusBadRequest)
+		return
+	}
+
+	grant, err := a.assetStorage.CreateGrant(r.Context(), types.AssetGrant{
+		OwnerID:      userID,
+		GranteeLogin: req.Grantee,
+		AssetName:    req.AssetName,
+		IsPrefix:     req.IsPrefix,
+		Permission:   req.Permission,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		case errors.Is(err, storage.ErrGrantToSelf):
+			http.Error(w, "Cannot grant access to yourself", http.StatusBadRequest)
+		default:
+			log.Printf("storage.CreateGrant error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(grantResponse(grant)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) handleListGrants(w http.ResponseWriter, r *http.Request, userID int64) {
+	grants, err := a.assetStorage.ListGrants(r.Context(), userID)
+	if err != nil {
+		log.Printf("storage.ListGrants error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListGrantsResponse{
+		Grants: make([]dto.Grant, 0, len(grants)),
+	}
+	for _, grant := range grants {
+		resp.Grants = append(resp.Grants, grantResponse(grant))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleDeleteGrant(w http.ResponseWriter, r *http.Request, userID, grantID int64) {
+	err := a.assetStorage.DeleteGrant(r.Context(), userID, grantID)
+	if err != nil {
+		if errors.Is(err, storage.ErrGrantNotFound) {
+			http.Error(w, "Grant not found", http.StatusNotFound)
+		} else {
+			log.Printf("storage.DeleteGrant error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) sharedAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireScope(w, auth, types.ScopeAssetsRead) {
+		return
+	}
+
+	limit, offset, err := parsePaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files, err := a.assetStorage.GetSharedAssetsList(r.Context(), auth.userID, limit, offset)
+	if err != nil {
+		log.Printf("storage.GetSharedAssetsList error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.GetUserAssetsListResponse{
+		Assets: files,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func grantResponse(grant types.AssetGrant) dto.Grant {
+	return dto.Grant{
+		ID:         grant.ID,
+		Grantee:    grant.GranteeLogin,
+		AssetName:  grant.AssetName,
+		IsPrefix:   grant.IsPrefix,
+		Permission: grant.Permission,
+		CreatedAt:  grant.CreatedAt,
+	}
+}
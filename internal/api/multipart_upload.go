@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// Multipart uploads let a client split a large file into numbered parts,
+// upload them concurrently and then commit them into a single asset:
+//
+//	POST   /api/multipart-upload/{name}                           initiate
+//	PUT    /api/multipart-upload/{name}?upload_id=&part_number=   upload part
+//	GET    /api/multipart-upload/{name}?upload_id=                list parts
+//	POST   /api/multipart-upload/{name}?upload_id=                complete
+//	DELETE /api/multipart-upload/{name}?upload_id=                abort
+const (
+	multipartUploadPathPrefix = "/api/multipart-upload/"
+	maxPartNumber             = 10000
+)
+
+func (a *API) multipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireScope(w, auth, types.ScopeAssetsWrite) {
+		return
+	}
+	assetName := strings.TrimPrefix(r.URL.Path, multipartUploadPathPrefix)
+	if assetName == "" {
+		http.Error(w, "Name is empty", http.StatusBadRequest)
+		return
+	}
+
+	// Every request names the asset, so access to the namespace is checked
+	// again for each part.
+	namespaceID, ok := a.resolveNamespace(w, r, auth.userID, assetName, true)
+	if !ok {
+		return
+	}
+
+	uploadID := r.URL.Query().Get("upload_id")
+	if uploadID == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Missing upload_id", http.StatusBadRequest)
+			return
+		}
+		a.handleInitiateMultipartUpload(w, r, namespaceID, assetName)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		a.handleUploadPart(w, r, namespaceID, assetName, uploadID)
+	case http.MethodGet:
+		a.handleListUploadParts(w, r, namespaceID, assetName, uploadID)
+	case http.MethodPost:
+		a.handleCompleteMultipartUpload(w, r, namespaceID, assetName, uploadID)
+	case http.MethodDelete:
+		a.handleAbortMultipartUpload(w, r, namespaceID, assetName, uploadID)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleInitiateMultipartUpload(w http.ResponseWriter, r *http.Request, userID int64, assetName string) {
+	var req dto.InitiateMultipartUploadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	contentType := defaultMediaType
+	if req.ContentType != "" {
+		mediaType, _, err := mime.ParseMediaType(req.ContentType)
+		if err != nil {
+			http.Error(w, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		contentType = mediaType
+	}
+
+	upload, err := a.assetStorage.CreateMultipartUpload(r.Context(), types.MultipartUpload{
+		UserID:       userID,
+		AssetName:    assetName,
+		OriginalName: req.OriginalName,
+		ContentType:  contentType,
+	})
+	if err != nil {
+		writeMultipartUploadError(w, "storage.CreateMultipartUpload", err)
+		return
+	}
+
+	resp := dto.InitiateMultipartUploadResponse{
+		UploadID:  upload.ID,
+		AssetName: upload.AssetName,
+		ExpiresAt: upload.ExpiresAt,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) handleUploadPart(w http.ResponseWriter, r *http.Request, userID int64, assetName, uploadID string) {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("part_number"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		http.Error(w, "Invalid part_number", http.StatusBadRequest)
+		return
+	}
+
+	if r.ContentLength > MAX_UPLOAD_SIZE {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_SIZE)
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			log.Printf("Error closing request body: %v", err)
+		}
+	}(r.Body)
+
+	part, err := a.assetStorage.UploadPart(r.Context(), userID, assetName, uploadID, partNumber, r.Body, MAX_UPLOAD_SIZE)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		} else {
+			writeMultipartUploadError(w, "storage.UploadPart", err)
+		}
+		return
+	}
+
+	resp := dto.UploadPartResponse{
+		PartNumber: part.PartNumber,
+		ETag:       part.ETag,
+		Size:       part.Size,
+	}
+	w.Header().Set("ETag", strconv.Quote(part.ETag))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) handleListUploadParts(w http.ResponseWriter, r *http.Request, userID int64, assetName, uploadID string) {
+	parts, err := a.assetStorage.ListUploadParts(r.Context(), userID, assetName, uploadID)
+	if err != nil {
+		writeMultipartUploadError(w, "storage.ListUploadParts", err)
+		return
+	}
+
+	resp := dto.ListUploadPartsResponse{
+		UploadID: uploadID,
+		Parts:    parts,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Request, userID int64, assetName, uploadID string) {
+	var req dto.CompleteMultipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	parts := make([]types.UploadPart, 0, len(req.Parts))
+	for _, part := range req.Parts {
+		parts = append(parts, types.UploadPart{
+			PartNumber: part.PartNumber,
+			ETag:       strings.Trim(part.ETag, `"`),
+		})
+	}
+
+	err := a.assetStorage.CompleteMultipartUpload(r.Context(), userID, assetName, uploadID, parts, MAX_UPLOAD_SIZE)
+	if err != nil {
+		writeMultipartUploadError(w, "storage.CompleteMultipartUpload", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": "ok"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) handleAbortMultipartUpload(w http.ResponseWriter, r *http.Request, userID int64, assetName, uploadID string) {
+	err := a.assetStorage.AbortMultipartUpload(r.Context(), userID, assetName, uploadID)
+	if err != nil {
+		writeMultipartUploadError(w, "storage.AbortMultipartUpload", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeMultipartUploadError(w http.ResponseWriter, operation string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrMultipartUploadNotFound):
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrAssetAlreadyExists):
+		http.Error(w, "Asset already exists", http.StatusConflict)
+	case errors.Is(err, storage.ErrInvalidPart):
+		http.Error(w, "Invalid part", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrInvalidPartOrder):
+		http.Error(w, "Invalid part order", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrAssetTooLarge):
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+	default:
+		log.Printf("%s error: %v", operation, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
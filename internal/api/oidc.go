@@ -0,0 +1,257 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ArturV19/file-storage/config"
+	"github.com/ArturV19/file-storage/internal/oidc"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// With an OpenID Connect provider configured users can log in there instead
+// of with a local password:
+//
+//	GET /api/auth/oidc/login      redirects to the provider
+//	GET /api/auth/oidc/callback   the provider redirects back here, returns the tokens like /api/auth
+//
+// Users are provisioned on their first login. Two-factor authentication is
+// left to the provider.
+const (
+	oidcLoginPath    = "/api/auth/oidc/login"
+	oidcCallbackPath = "/api/auth/oidc/callback"
+	oidcLoginTTL     = 10 * time.Minute
+	// oidcStateCookie binds a login to the browser that started it, so an
+	// attacker can't have a victim complete the attacker's login. It holds
+	// the SHA-256 of the state.
+	oidcStateCookie = "oidc_state"
+
+	// maxLoginSuffix bounds the numbered variants of a name offered to a
+	// provisioned user whose name is taken.
+	maxLoginSuffix = 100
+	// generatedLogins is how many random logins are offered to a
+	// provisioned user after the names from the claims.
+	generatedLogins = 3
+)
+
+func newOIDCProvider(oidcCfg config.OIDCConfig) *oidc.Provider {
+	if !oidcCfg.Enabled() {
+		return nil
+	}
+
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       oidcCfg.Issuer,
+		ClientID:     oidcCfg.ClientID,
+		ClientSecret: oidcCfg.ClientSecret,
+		RedirectURL:  oidcCfg.RedirectURL,
+		Scopes:       oidcCfg.Scopes,
+	})
+}
+
+func (a *API) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := oidc.NewNonce()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := a.oidcProvider.AuthCodeURL(r.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("oidc.AuthCodeURL error: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	err = a.userStorage.CreateOIDCLoginState(r.Context(), types.OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		log.Printf("storage.CreateOIDCLoginState error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.setOIDCStateCookie(w, oidcStateHash(state), int(oidcLoginTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (a *API) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(w, "Login failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		http.Error(w, "Missing code or state", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(oidcStateHash(state))) != 1 {
+		http.Error(w, "Invalid or expired login state", http.StatusUnauthorized)
+		return
+	}
+	a.setOIDCStateCookie(w, "", -1)
+
+	loginState, err := a.userStorage.ConsumeOIDCLoginState(r.Context(), state)
+	if err != nil {
+		if errors.Is(err, storage.ErrLoginStateNotFound) {
+			http.Error(w, "Invalid or expired login state", http.StatusUnauthorized)
+		} else {
+			log.Printf("storage.ConsumeOIDCLoginState error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	claims, err := a.oidcProvider.Exchange(r.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) || errors.Is(err, oidc.ErrExpiredToken) || errors.Is(err, oidc.ErrInvalidNonce) {
+			http.Error(w, "Invalid ID token", http.StatusUnauthorized)
+		} else {
+			log.Printf("oidc.Exchange error: %v", err)
+			http.Error(w, "Identity provider error", http.StatusBadGateway)
+		}
+		return
+	}
+
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid IP address", http.StatusInternalServerError)
+		return
+	}
+
+	logins, err := a.provisioningLogins(claims)
+	if err != nil {
+		log.Printf("Error choosing a login for subject %q: %v", claims.Subject, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	identity := types.ExternalIdentity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Logins:  logins,
+	}
+	authData := types.AuthData{
+		IPAddress: ipAddress,
+		UserAgent: r.UserAgent(),
+	}
+
+	tokens, err := a.userStorage.NewExternalSession(r.Context(), identity, authData)
+	if err != nil {
+		if errors.Is(err, storage.ErrAccountDisabled) {
+			http.Error(w, "Account disabled", http.StatusForbidden)
+		} else {
+			log.Printf("storage.NewExternalSession error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	a.writeSessionTokens(w, tokens)
+}
+
+// provisioningLogins returns the logins a user provisioned from the claims
+// may get, in order of preference: the preferred username, the email address
+// and its local part, each followed by numbered variants, and a few generated
+// logins last. Only logins the account policy accepts are offered, so users
+// whose names at the provider aren't valid logins are still provisioned.
+func (a *API) provisioningLogins(claims oidc.Claims) ([]string, error) {
+	var names []string
+	for _, name := range []string{claims.PreferredUsername, claims.Email} {
+		name = strings.TrimSpace(name)
+		names = append(names, name)
+		if at := strings.LastIndex(name, "@"); at > 0 {
+			names = append(names, name[:at])
+		}
+	}
+
+	var logins []string
+	seen := make(map[string]struct{})
+	offer := func(login string) {
+		if _, ok := seen[login]; ok || len(a.accountPolicy.ValidateLogin(login)) > 0 {
+			return
+		}
+		seen[login] = struct{}{}
+		logins = append(logins, login)
+	}
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		offer(name)
+		for suffix := 2; suffix <= maxLoginSuffix; suffix++ {
+			offer(fmt.Sprintf("%s-%d", name, suffix))
+		}
+	}
+
+	for i := 0; i < generatedLogins; i++ {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		offer("user-" + hex.EncodeToString(b))
+	}
+
+	if len(logins) == 0 {
+		return nil, errors.New("the account policy rejects all logins")
+	}
+	return logins, nil
+}
+
+// setOIDCStateCookie sets the login state cookie, or deletes it with a
+// negative maxAge. It is only sent to the callback, and only over HTTPS if
+// the callback is served over HTTPS.
+func (a *API) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcCallbackPath,
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(a.oidcProvider.RedirectURL(), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func oidcStateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
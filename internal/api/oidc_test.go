@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ArturV19/file-storage/config"
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/oidc"
+	"github.com/ArturV19/file-storage/internal/oidc/oidctest"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+	"github.com/ArturV19/file-storage/internal/validation"
+)
+
+// oidcUserStorage keeps login states in memory and records the identities
+// sessions are started for. Other methods of userStorage aren't used by the
+// login.
+type oidcUserStorage struct {
+	userStorage
+
+	mu         sync.Mutex
+	states     map[string]types.OIDCLoginState
+	identities []types.ExternalIdentity
+}
+
+func (s *oidcUserStorage) CreateOIDCLoginState(ctx context.Context, state types.OIDCLoginState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.State] = state
+	return nil
+}
+
+func (s *oidcUserStorage) ConsumeOIDCLoginState(ctx context.Context, state string) (types.OIDCLoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loginState, ok := s.states[state]
+	delete(s.states, state)
+	if !ok {
+		return types.OIDCLoginState{}, storage.ErrLoginStateNotFound
+	}
+	return loginState, nil
+}
+
+func (s *oidcUserStorage) NewExternalSession(ctx context.Context, identity types.ExternalIdentity, authData types.AuthData) (types.SessionTokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities = append(s.identities, identity)
+	return types.SessionTokens{
+		UserID:       1,
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}, nil
+}
+
+func testAccountPolicy(t *testing.T) *validation.Policy {
+	t.Helper()
+
+	policy, err := validation.NewPolicy(config.AccountPolicyConfig{
+		LoginMinLength: 3,
+		LoginMaxLength: 32,
+		LoginPattern:   `^[A-Za-z0-9][A-Za-z0-9._-]*$`,
+		LoginReserved:  []string{"admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+// startMockIdP starts a mock identity provider and returns it with its issuer
+// URL, the URL of the server with the suffix appended.
+func startMockIdP(t *testing.T, suffix string, cfg oidctest.Config) (string, *oidctest.Provider) {
+	t.Helper()
+
+	idpServer := httptest.NewUnstartedServer(nil)
+	cfg.Issuer = "http://" + idpServer.Listener.Addr().String() + suffix
+	idp, err := oidctest.NewProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unlike http.ServeMux most providers don't redirect to the clean path,
+	// so URLs built by appending to an issuer ending with a slash must fail.
+	idpServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "//") {
+			http.NotFound(w, r)
+			return
+		}
+		idp.ServeHTTP(w, r)
+	})
+	idpServer.Start()
+	t.Cleanup(idpServer.Close)
+
+	return cfg.Issuer, idp
+}
+
+// newOIDCTestAPI returns an API logging in through a mock identity provider.
+func newOIDCTestAPI(t *testing.T) (*API, *oidcUserStorage) {
+	t.Helper()
+	return newOIDCTestAPIWithIssuerSuffix(t, "")
+}
+
+// newOIDCTestAPIWithIssuerSuffix is newOIDCTestAPI with the suffix appended
+// to the issuer URL of the provider.
+func newOIDCTestAPIWithIssuerSuffix(t *testing.T, suffix string) (*API, *oidcUserStorage) {
+	t.Helper()
+
+	issuer, _ := startMockIdP(t, suffix, oidctest.Config{ClientID: "file-storage", User: "alice"})
+
+	users := &oidcUserStorage{states: make(map[string]types.OIDCLoginState)}
+	a := &API{
+		userStorage:   users,
+		accountPolicy: testAccountPolicy(t),
+		oidcProvider: oidc.NewProvider(oidc.Config{
+			Issuer:      issuer,
+			ClientID:    "file-storage",
+			RedirectURL: "http://files.example.com" + oidcCallbackPath,
+			Scopes:      []string{"openid"},
+		}),
+	}
+	return a, users
+}
+
+// oidcLogin goes through the login with the user, following the redirects
+// to the provider and back, and returns the response of the callback.
+func oidcLogin(t *testing.T, a *API, loginHint string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	callbackURL, cookies := startOIDCLogin(t, a, loginHint)
+	return oidcCallback(a, callbackURL, cookies)
+}
+
+// startOIDCLogin starts the login with the user and follows the redirect to
+// the provider. It returns the callback URL the provider redirects back to
+// and the cookies set by the login.
+func startOIDCLogin(t *testing.T, a *API, loginHint string) (string, []*http.Cookie) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	a.oidcLoginHandler(recorder, httptest.NewRequest(http.MethodGet, oidcLoginPath, nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d: %s", recorder.Code, http.StatusFound, recorder.Body.String())
+	}
+
+	authURL, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+	query.Set("login_hint", loginHint)
+	authURL.RawQuery = query.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	callbackURL, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callbackURL.Path != oidcCallbackPath {
+		t.Fatalf("redirected to %s, want the callback", callbackURL)
+	}
+
+	return callbackURL.RequestURI(), recorder.Result().Cookies()
+}
+
+func oidcCallback(a *API, callbackURL string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, callbackURL, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+
+	recorder := httptest.NewRecorder()
+	a.oidcCallbackHandler(recorder, r)
+	return recorder
+}
+
+func TestOIDCLoginStartsSession(t *testing.T) {
+	a, users := newOIDCTestAPI(t)
+
+	recorder := oidcLogin(t, a, "alice")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+
+	var resp dto.AuthenticateUserResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Token != "access-token" || resp.RefreshToken != "refresh-token" {
+		t.Fatalf("tokens = %+v", resp)
+	}
+
+	if len(users.identities) != 1 {
+		t.Fatalf("started %d sessions, want 1", len(users.identities))
+	}
+	identity := users.identities[0]
+	if identity.Subject != oidctest.SubPrefix+"alice" {
+		t.Fatalf("subject = %q", identity.Subject)
+	}
+	if len(identity.Logins) == 0 || identity.Logins[0] != "alice" {
+		t.Fatalf("logins = %v, want alice first", identity.Logins)
+	}
+}
+
+func TestOIDCLoginWithTrailingSlashIssuer(t *testing.T) {
+	a, users := newOIDCTestAPIWithIssuerSuffix(t, "/")
+
+	recorder := oidcLogin(t, a, "alice")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+	if len(users.identities) != 1 || !strings.HasSuffix(users.identities[0].Issuer, "/") {
+		t.Fatalf("identities = %+v, want one with the issuer as configured", users.identities)
+	}
+}
+
+func TestOIDCCallbackRejectsUnknownState(t *testing.T) {
+	a, _ := newOIDCTestAPI(t)
+
+	recorder := httptest.NewRecorder()
+	a.oidcCallbackHandler(recorder, httptest.NewRequest(http.MethodGet, oidcCallbackPath+"?code=code&state=unknown", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCLoginSetsStateCookie(t *testing.T) {
+	a, _ := newOIDCTestAPI(t)
+
+	_, cookies := startOIDCLogin(t, a, "alice")
+	if len(cookies) != 1 {
+		t.Fatalf("set %d cookies, want 1", len(cookies))
+	}
+	cookie := cookies[0]
+	if cookie.Name != oidcStateCookie || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != oidcCallbackPath {
+		t.Fatalf("cookie = %+v", cookie)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	a, users := newOIDCTestAPI(t)
+
+	// The attacker starts a login and has the victim's browser, which holds
+	// the cookie of another login, open the callback.
+	attackerCallback, _ := startOIDCLogin(t, a, "mallory")
+	_, victimCookies := startOIDCLogin(t, a, "alice")
+
+	for name, cookies := range map[string][]*http.Cookie{"no cookie": nil, "another login's cookie": victimCookies} {
+		if recorder := oidcCallback(a, attackerCallback, cookies); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("callback with %s: status = %d, want %d", name, recorder.Code, http.StatusUnauthorized)
+		}
+	}
+	if len(users.identities) != 0 {
+		t.Fatalf("started %d sessions, want none", len(users.identities))
+	}
+}
+
+func TestOIDCLoginOffersOnlyValidLogins(t *testing.T) {
+	a, users := newOIDCTestAPI(t)
+
+	for _, hint := range []string{"admin", "bob smith"} {
+		if recorder := oidcLogin(t, a, hint); recorder.Code != http.StatusOK {
+			t.Fatalf("callback status for %q = %d: %s", hint, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	policy := testAccountPolicy(t)
+	for _, identity := range users.identities {
+		for _, login := range identity.Logins {
+			if errs := policy.ValidateLogin(login); len(errs) > 0 {
+				t.Errorf("offered invalid login %q: %v", login, errs)
+			}
+		}
+	}
+
+	if logins := users.identities[0].Logins; logins[0] != "admin-2" {
+		t.Errorf("logins for admin start with %q, want admin-2", logins[0])
+	}
+	if logins := users.identities[1].Logins; !strings.HasPrefix(logins[0], "user-") {
+		t.Errorf("logins for a name that isn't a valid login start with %q, want a generated one", logins[0])
+	}
+}
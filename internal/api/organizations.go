@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// Organizations are shared asset namespaces:
+//
+//	POST   /api/orgs                          create an organization, the caller becomes its owner
+//	GET    /api/orgs                          list own organizations with the caller's role
+//	GET    /api/orgs/{name}/members           list members
+//	PUT    /api/orgs/{name}/members/{login}   add a member or change their role (owners only)
+//	DELETE /api/orgs/{name}/members/{login}   remove a member (owners, or the member themselves)
+//
+// Assets of an organization are accessed through the usual asset endpoints
+// with its name in the org query parameter.
+const (
+	orgsPath       = "/api/orgs"
+	orgMembersPath = "members"
+	orgParam       = "org"
+)
+
+func (a *API) orgsHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+	userID := auth.userID
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, orgsPath), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodPost:
+			a.handleCreateOrganization(w, r, userID)
+		case http.MethodGet:
+			a.handleListOrganizations(w, r, userID)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	segments := strings.Split(path, "/")
+	if len(segments) < 2 || len(segments) > 3 || segments[1] != orgMembersPath {
+		http.NotFound(w, r)
+		return
+	}
+	orgName := segments[0]
+
+	if len(segments) == 2 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleListOrganizationMembers(w, r, userID, orgName)
+		return
+	}
+
+	login := segments[2]
+	switch r.Method {
+	case http.MethodPut:
+		a.handleSetOrganizationMember(w, r, userID, orgName, login)
+	case http.MethodDelete:
+		a.handleRemoveOrganizationMember(w, r, userID, orgName, login)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleCreateOrganization(w http.ResponseWriter, r *http.Request, userID int64) {
+	var req dto.CreateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || strings.Contains(req.Name, "/") {
+		http.Error(w, "Invalid name", http.StatusBadRequest)
+		return
+	}
+
+	org, err := a.assetStorage.CreateOrganization(r.Context(), userID, req.Name)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrganizationAlreadyExists) {
+			http.Error(w, "Organization already exists", http.StatusConflict)
+		} else {
+			log.Printf("storage.CreateOrganization error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(organizationResponse(org)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) handleListOrganizations(w http.ResponseWriter, r *http.Request, userID int64) {
+	orgs, err := a.assetStorage.ListOrganizations(r.Context(), userID)
+	if err != nil {
+		log.Printf("storage.ListOrganizations error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListOrganizationsResponse{
+		Organizations: make([]dto.Organization, 0, len(orgs)),
+	}
+	for _, org := range orgs {
+		resp.Organizations = append(resp.Organizations, organizationResponse(org))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleListOrganizationMembers(w http.ResponseWriter, r *http.Request, userID int64, orgName string) {
+	members, err := a.assetStorage.ListOrganizationMembers(r.Context(), userID, orgName)
+	if err != nil {
+		writeOrganizationError(w, "storage.ListOrganizationMembers", err)
+		return
+	}
+
+	resp := dto.ListOrganizationMembersResponse{
+		Members: make([]dto.OrganizationMember, 0, len(members)),
+	}
+	for _, member := range members {
+		resp.Members = append(resp.Members, dto.OrganizationMember{
+			Login:     member.Login,
+			Role:      member.Role,
+			CreatedAt: member.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleSetOrganizationMember(w http.ResponseWriter, r *http.Request, userID int64, orgName, login string) {
+	var req dto.SetOrganizationMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role != types.RoleOwner && req.Role != types.RoleEditor && req.Role != types.RoleViewer {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	err := a.assetStorage.SetOrganizationMember(r.Context(), userID, orgName, login, req.Role)
+	if err != nil {
+		writeOrganizationError(w, "storage.SetOrganizationMember", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleRemoveOrganizationMember(w http.ResponseWriter, r *http.Request, userID int64, orgName, login string) {
+	err := a.assetStorage.RemoveOrganizationMember(r.Context(), userID, orgName, login)
+	if err != nil {
+		writeOrganizationError(w, "storage.RemoveOrganizationMember", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeOrganizationError(w http.ResponseWriter, operation string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrOrganizationNotFound):
+		http.Error(w, "Organization not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrUserNotFound), errors.Is(err, storage.ErrMemberNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrAccessDenied):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case errors.Is(err, storage.ErrLastOwner):
+		http.Error(w, "Organization must keep an owner", http.StatusConflict)
+	default:
+		log.Printf("%s error: %v", operation, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func organizationResponse(org types.Organization) dto.Organization {
+	return dto.Organization{
+		Name:      org.Name,
+		Role:      org.Role,
+		CreatedAt: org.CreatedAt,
+	}
+}
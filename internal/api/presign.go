@@ -0,0 +1,213 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// Presigned URLs grant access to a single download or upload without a bearer
+// token. The URL carries the user, allowed method, expiry and optional upload
+// constraints, and an HMAC-SHA256 signature over the method, path and all of
+// its query parameters. Only URLs with a valid signature cost a database
+// lookup, to check that the user is still active.
+const (
+	presignUserParam        = "X-Uid"
+	presignMethodParam      = "X-Method"
+	presignExpiresParam     = "X-Expires"
+	presignMaxSizeParam     = "X-Max-Size"
+	presignContentTypeParam = "X-Content-Type"
+	presignSignatureParam   = "X-Signature"
+)
+
+const (
+	presignDefaultExpiry = 1 * time.Hour
+	presignMaxExpiry     = 7 * 24 * time.Hour
+)
+
+type presignedURL struct {
+	userID      int64
+	method      string
+	expiresAt   time.Time
+	maxSize     int64
+	contentType string
+}
+
+// presignHandler issues a presigned URL for an asset of the caller.
+func (a *API) presignHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.PresignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.AssetName == "" {
+		http.Error(w, "Name is empty", http.StatusBadRequest)
+		return
+	}
+
+	var path, scope string
+	switch req.Method {
+	case http.MethodGet:
+		path = "/api/asset/" + req.AssetName
+		scope = types.ScopeAssetsRead
+	case http.MethodPost, http.MethodPut:
+		path = "/api/upload-asset/" + req.AssetName
+		scope = types.ScopeAssetsWrite
+	default:
+		http.Error(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+	if !requireScope(w, auth, scope) {
+		return
+	}
+
+	if req.ExpiresIn < 0 || req.ExpiresIn > int64(presignMaxExpiry/time.Second) {
+		http.Error(w, "Invalid expires_in", http.StatusBadRequest)
+		return
+	}
+	expiresIn := presignDefaultExpiry
+	if req.ExpiresIn != 0 {
+		expiresIn = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	if req.MaxSize < 0 || req.MaxSize > MAX_UPLOAD_SIZE {
+		http.Error(w, "Invalid max_size", http.StatusBadRequest)
+		return
+	}
+
+	if req.ContentType != "" {
+		mediaType, _, err := mime.ParseMediaType(req.ContentType)
+		if err != nil {
+			http.Error(w, "Invalid content_type", http.StatusBadRequest)
+			return
+		}
+		req.ContentType = mediaType
+	}
+
+	expiresAt := time.Now().Add(expiresIn)
+	query := url.Values{}
+	query.Set(presignUserParam, strconv.FormatInt(auth.userID, 10))
+	query.Set(presignMethodParam, req.Method)
+	query.Set(presignExpiresParam, strconv.FormatInt(expiresAt.Unix(), 10))
+	if req.Method != http.MethodGet {
+		if req.MaxSize > 0 {
+			query.Set(presignMaxSizeParam, strconv.FormatInt(req.MaxSize, 10))
+		}
+		if req.ContentType != "" {
+			query.Set(presignContentTypeParam, req.ContentType)
+		}
+	}
+	if req.Method == http.MethodGet && req.Version > 0 {
+		query.Set("version", strconv.Itoa(req.Version))
+	}
+	query.Set(presignSignatureParam, a.presignSignature(req.Method, path, query))
+
+	signedURL := url.URL{Path: path, RawQuery: query.Encode()}
+	resp := dto.PresignResponse{
+		URL:       signedURL.String(),
+		Method:    req.Method,
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) verifyPresignedURL(r *http.Request) (*presignedURL, error) {
+	query := r.URL.Query()
+	signature, err := hex.DecodeString(query.Get(presignSignatureParam))
+	if err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	method := query.Get(presignMethodParam)
+	expected, _ := hex.DecodeString(a.presignSignature(method, r.URL.Path, query))
+	if !hmac.Equal(signature, expected) {
+		return nil, errors.New("invalid signature")
+	}
+
+	if r.Method != method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+		return nil, errors.New("method not allowed by signature")
+	}
+
+	expires, err := strconv.ParseInt(query.Get(presignExpiresParam), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid expiry")
+	}
+	expiresAt := time.Unix(expires, 0)
+	if time.Now().After(expiresAt) {
+		return nil, errors.New("url expired")
+	}
+
+	userID, err := strconv.ParseInt(query.Get(presignUserParam), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid user")
+	}
+
+	// URLs are valid until they expire, the user may have been disabled or
+	// deleted since.
+	if err := a.userStorage.CheckUserActive(r.Context(), userID); err != nil {
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			log.Printf("storage.CheckUserActive error: %v", err)
+		}
+		return nil, errors.New("invalid user")
+	}
+
+	var maxSize int64
+	if maxSizeStr := query.Get(presignMaxSizeParam); maxSizeStr != "" {
+		maxSize, err = strconv.ParseInt(maxSizeStr, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid max size")
+		}
+	}
+
+	return &presignedURL{
+		userID:      userID,
+		method:      method,
+		expiresAt:   expiresAt,
+		maxSize:     maxSize,
+		contentType: query.Get(presignContentTypeParam),
+	}, nil
+}
+
+// presignSignature signs the method, the decoded path and the query without
+// the signature itself. url.Values.Encode sorts the keys, so the result does
+// not depend on the parameter order in the URL.
+func (a *API) presignSignature(method, path string, query url.Values) string {
+	unsigned := url.Values{}
+	for key, values := range query {
+		if key != presignSignatureParam {
+			unsigned[key] = values
+		}
+	}
+
+	mac := hmac.New(sha256.New, a.urlSigningKey)
+	mac.Write([]byte(strings.Join([]string{method, path, unsigned.Encode()}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
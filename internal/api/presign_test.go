@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ArturV19/file-storage/internal/storage"
+)
+
+// presignUserStorage knows a single active user.
+type presignUserStorage struct {
+	userStorage
+
+	activeUserID int64
+}
+
+func (s *presignUserStorage) CheckUserActive(ctx context.Context, userID int64) error {
+	if userID != s.activeUserID {
+		return storage.ErrUserNotFound
+	}
+	return nil
+}
+
+func presignedRequest(a *API, userID int64, method string) *http.Request {
+	path := "/api/asset/report.txt"
+	query := url.Values{}
+	query.Set(presignUserParam, strconv.FormatInt(userID, 10))
+	query.Set(presignMethodParam, method)
+	query.Set(presignExpiresParam, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	query.Set(presignSignatureParam, a.presignSignature(method, path, query))
+
+	return httptest.NewRequest(method, path+"?"+query.Encode(), nil)
+}
+
+func TestPresignedURLOfActiveUser(t *testing.T) {
+	a := &API{userStorage: &presignUserStorage{activeUserID: 1}, urlSigningKey: []byte("key")}
+
+	auth, err := a.authorize(presignedRequest(a, 1, http.MethodGet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.userID != 1 || auth.presigned == nil {
+		t.Fatalf("auth = %+v", auth)
+	}
+}
+
+func TestPresignedURLOfInactiveUser(t *testing.T) {
+	a := &API{userStorage: &presignUserStorage{activeUserID: 1}, urlSigningKey: []byte("key")}
+
+	// A disabled or deleted user, including an upload URL issued before.
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		if _, err := a.authorize(presignedRequest(a, 2, method)); err == nil {
+			t.Errorf("%s URL of an inactive user accepted", method)
+		}
+	}
+}
+
+func TestPresignedURLWithInvalidSignature(t *testing.T) {
+	a := &API{userStorage: &presignUserStorage{activeUserID: 1}, urlSigningKey: []byte("key")}
+
+	r := presignedRequest(a, 1, http.MethodGet)
+	query := r.URL.Query()
+	query.Set(presignUserParam, "2")
+	r.URL.RawQuery = query.Encode()
+
+	if _, err := a.authorize(r); err == nil {
+		t.Fatal("URL with a changed user accepted")
+	}
+}
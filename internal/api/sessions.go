@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+)
+
+// Every login starts an independent session:
+//
+//	POST   /api/logout          revoke the current session
+//	GET    /api/sessions        list own sessions
+//	DELETE /api/sessions        revoke all sessions except the current one
+//	DELETE /api/sessions/{id}   revoke a session
+const (
+	logoutPath   = "/api/logout"
+	sessionsPath = "/api/sessions"
+)
+
+func (a *API) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+
+	if err := a.userStorage.Logout(r.Context(), auth.sessionID); err != nil {
+		log.Printf("storage.Logout error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	a.sessionsRevoked(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+
+	sessionID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, sessionsPath), "/")
+	if sessionID != "" {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleDeleteSession(w, r, auth.userID, sessionID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.handleListSessions(w, r, auth)
+	case http.MethodDelete:
+		a.handleDeleteOtherSessions(w, r, auth)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleListSessions(w http.ResponseWriter, r *http.Request, auth *authContext) {
+	sessions, err := a.userStorage.ListSessions(r.Context(), auth.userID, auth.sessionID)
+	if err != nil {
+		log.Printf("storage.ListSessions error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListSessionsResponse{
+		Sessions: make([]dto.Session, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, dto.Session{
+			ID:        session.ID,
+			IPAddress: session.IPAddress,
+			UserAgent: session.UserAgent,
+			CreatedAt: session.CreatedAt,
+			ExpiresAt: session.ExpiresAt,
+			Current:   session.Current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleDeleteOtherSessions(w http.ResponseWriter, r *http.Request, auth *authContext) {
+	if err := a.userStorage.DeleteOtherSessions(r.Context(), auth.userID, auth.sessionID); err != nil {
+		log.Printf("storage.DeleteOtherSessions error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	a.sessionsRevoked(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleDeleteSession(w http.ResponseWriter, r *http.Request, userID int64, sessionID string) {
+	err := a.userStorage.DeleteSession(r.Context(), userID, sessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		} else {
+			log.Printf("storage.DeleteSession error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	a.sessionsRevoked(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionsRevoked makes revocations take effect on this instance right away
+// rather than on the next reload of the revocation list.
+func (a *API) sessionsRevoked(ctx context.Context) {
+	if err := a.reloadRevokedSessions(ctx); err != nil {
+		log.Printf("Failed to reload revoked sessions: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// Share links give people without an account access to an asset:
+//
+//	POST   /api/share-links        create a link to an own asset
+//	GET    /api/share-links        list own links
+//	DELETE /api/share-links/{id}   revoke a link
+//	GET    /api/public/{id}        download through a link, no authorization
+//
+// A password protected link expects the password in the X-Share-Password
+// header. Wrong passwords are throttled like failed logins.
+const (
+	shareLinksPath       = "/api/share-links"
+	publicPathPrefix     = "/api/public/"
+	sharePasswordHeader  = "X-Share-Password"
+	shareLinkMaxLifetime = 365 * 24 * time.Hour
+)
+
+func (a *API) shareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+	userID := auth.userID
+
+	linkID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, shareLinksPath), "/")
+	if linkID != "" {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleDeleteShareLink(w, r, userID, linkID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		a.handleCreateShareLink(w, r, userID)
+	case http.MethodGet:
+		a.handleListShareLinks(w, r, userID)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleCreateShareLink(w http.ResponseWriter, r *http.Request, userID int64) {
+	var req dto.CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.AssetName == "" {
+		http.Error(w, "Name is empty", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresIn < 0 || req.ExpiresIn > int64(shareLinkMaxLifetime/time.Second) {
+		http.Error(w, "Invalid expires_in", http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		http.Error(w, "Invalid max_downloads", http.StatusBadRequest)
+		return
+	}
+
+	link := types.ShareLink{
+		UserID:       userID,
+		AssetName:    req.AssetName,
+		MaxDownloads: req.MaxDownloads,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		link.ExpiresAt = &expiresAt
+	}
+
+	link, err := a.assetStorage.CreateShareLink(r.Context(), link, req.Password)
+	if err != nil {
+		if errors.Is(err, storage.ErrAssetNotFound) {
+			http.Error(w, "Asset not found", http.StatusNotFound)
+		} else {
+			log.Printf("storage.CreateShareLink error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(shareLinkResponse(link)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (a *API) handleListShareLinks(w http.ResponseWriter, r *http.Request, userID int64) {
+	links, err := a.assetStorage.ListShareLinks(r.Context(), userID)
+	if err != nil {
+		log.Printf("storage.ListShareLinks error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.ListShareLinksResponse{
+		ShareLinks: make([]dto.ShareLink, 0, len(links)),
+	}
+	for _, link := range links {
+		resp.ShareLinks = append(resp.ShareLinks, shareLinkResponse(link))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleDeleteShareLink(w http.ResponseWriter, r *http.Request, userID int64, linkID string) {
+	err := a.assetStorage.DeleteShareLink(r.Context(), userID, linkID)
+	if err != nil {
+		if errors.Is(err, storage.ErrShareLinkNotFound) {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		} else {
+			log.Printf("storage.DeleteShareLink error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publicAssetHandler serves an asset through a share link. Only full 200
+// responses count as downloads; HEAD requests, 304 Not Modified and partial
+// responses don't. Links with a download limit ignore Range, so every
+// download through them is a full, counted one.
+func (a *API) publicAssetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	linkID := strings.TrimPrefix(r.URL.Path, publicPathPrefix)
+	if linkID == "" {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid IP address", http.StatusInternalServerError)
+		return
+	}
+
+	link, content, err := a.assetStorage.OpenSharedAsset(r.Context(), linkID, r.Header.Get(sharePasswordHeader), ipAddress)
+	if err != nil {
+		var throttled *storage.LoginThrottledError
+		switch {
+		case errors.Is(err, storage.ErrShareLinkNotFound), errors.Is(err, storage.ErrAssetNotFound):
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		case errors.Is(err, storage.ErrShareLinkExpired), errors.Is(err, storage.ErrShareLinkExhausted):
+			http.Error(w, "Share link is no longer available", http.StatusGone)
+		case errors.Is(err, storage.ErrInvalidSharePassword):
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+		case errors.As(err, &throttled):
+			writeLoginThrottled(w, throttled)
+		default:
+			log.Printf("storage.OpenSharedAsset error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if link.MaxDownloads != nil {
+		r.Header.Del("Range")
+		r.Header.Del("If-Range")
+	}
+
+	if r.Method == http.MethodGet {
+		w = &shareDownloadWriter{
+			ResponseWriter: w,
+			count: func() error {
+				return a.assetStorage.CountShareLinkDownload(r.Context(), linkID)
+			},
+		}
+	}
+
+	serveAsset(w, r, linkID, content)
+}
+
+var errShareDownloadRejected = errors.New("share link download rejected")
+
+// shareDownloadWriter counts a download when a 200 response starts. If the
+// link has been used up in the meantime, the response becomes 410 Gone and
+// the body is discarded.
+type shareDownloadWriter struct {
+	http.ResponseWriter
+	count       func() error
+	wroteHeader bool
+	rejected    bool
+}
+
+func (w *shareDownloadWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status == http.StatusOK {
+		if err := w.count(); err != nil {
+			w.rejected = true
+			for _, header := range []string{"Content-Length", "Content-Disposition", "ETag", "Last-Modified", "Accept-Ranges", "X-Asset-Version"} {
+				w.Header().Del(header)
+			}
+			if errors.Is(err, storage.ErrShareLinkExhausted) {
+				http.Error(w.ResponseWriter, "Share link is no longer available", http.StatusGone)
+			} else {
+				log.Printf("storage.CountShareLinkDownload error: %v", err)
+				http.Error(w.ResponseWriter, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *shareDownloadWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.rejected {
+		return 0, errShareDownloadRejected
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func shareLinkResponse(link types.ShareLink) dto.ShareLink {
+	return dto.ShareLink{
+		ID:            link.ID,
+		URL:           publicPathPrefix + link.ID,
+		AssetName:     link.AssetName,
+		HasPassword:   link.HasPassword,
+		ExpiresAt:     link.ExpiresAt,
+		MaxDownloads:  link.MaxDownloads,
+		DownloadCount: link.DownloadCount,
+		CreatedAt:     link.CreatedAt,
+	}
+}
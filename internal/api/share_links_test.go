@@ -0,0 +1,99 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error { return nil }
+
+func serveSharedContent(t *testing.T, r *http.Request, countErr error) (*httptest.ResponseRecorder, int) {
+	t.Helper()
+
+	counted := 0
+	recorder := httptest.NewRecorder()
+	w := &shareDownloadWriter{
+		ResponseWriter: recorder,
+		count: func() error {
+			counted++
+			return countErr
+		},
+	}
+
+	serveAsset(w, r, "report.txt", &types.AssetContent{
+		Body:        nopReadSeekCloser{strings.NewReader("shared content")},
+		Version:     1,
+		ContentType: "text/plain",
+		ETag:        "abc",
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	return recorder, counted
+}
+
+func TestShareDownloadWriterCountsFullResponses(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/public/link", nil)
+
+	recorder, counted := serveSharedContent(t, r, nil)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "shared content" {
+		t.Fatalf("response = %d %q", recorder.Code, recorder.Body.String())
+	}
+	if counted != 1 {
+		t.Fatalf("counted %d downloads, want 1", counted)
+	}
+}
+
+func TestShareDownloadWriterSkipsNotModified(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/public/link", nil)
+	r.Header.Set("If-None-Match", `"abc"`)
+
+	recorder, counted := serveSharedContent(t, r, nil)
+	if recorder.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusNotModified)
+	}
+	if counted != 0 {
+		t.Fatalf("counted %d downloads, want 0", counted)
+	}
+}
+
+func TestShareDownloadWriterSkipsPartialResponses(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/public/link", nil)
+	r.Header.Set("Range", "bytes=0-5")
+
+	recorder, counted := serveSharedContent(t, r, nil)
+	if recorder.Code != http.StatusPartialContent || recorder.Body.String() != "shared" {
+		t.Fatalf("response = %d %q", recorder.Code, recorder.Body.String())
+	}
+	if counted != 0 {
+		t.Fatalf("counted %d downloads, want 0", counted)
+	}
+}
+
+func TestShareDownloadWriterRejectsExhaustedLink(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/public/link", nil)
+
+	recorder, counted := serveSharedContent(t, r, storage.ErrShareLinkExhausted)
+	if recorder.Code != http.StatusGone {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusGone)
+	}
+	if counted != 1 {
+		t.Fatalf("counted %d downloads, want 1", counted)
+	}
+	if strings.Contains(recorder.Body.String(), "shared content") {
+		t.Fatal("content was sent for an exhausted link")
+	}
+	if recorder.Header().Get("ETag") != "" {
+		t.Fatal("ETag of the content was sent for an exhausted link")
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ArturV19/file-storage/config"
+	"github.com/ArturV19/file-storage/internal/token"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// In the signed token mode access tokens are verified without a database
+// lookup. Logging out still works through the revocation list of sessions,
+// which every instance keeps in memory and reloads periodically, so a
+// revocation made on another instance takes effect within
+// revokedSessionsReloadInterval.
+const revokedSessionsReloadInterval = 30 * time.Second
+
+// sessionScopes are carried by signed tokens issued for sessions, which may
+// do everything an API key can.
+var sessionScopes = []string{types.ScopeAssetsRead, types.ScopeAssetsWrite, types.ScopeAssetsDelete}
+
+type revokedSessions struct {
+	mu         sync.RWMutex
+	sessionIDs map[string]struct{}
+}
+
+func (l *revokedSessions) contains(sessionID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.sessionIDs[sessionID]
+	return ok
+}
+
+func (l *revokedSessions) set(sessionIDs []string) {
+	revoked := make(map[string]struct{}, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		revoked[sessionID] = struct{}{}
+	}
+
+	l.mu.Lock()
+	l.sessionIDs = revoked
+	l.mu.Unlock()
+}
+
+func newTokenSigner(authCfg config.AuthConfig) (*token.Signer, error) {
+	if authCfg.TokenMode != config.TokenModeSigned {
+		return nil, nil
+	}
+
+	keys := make(map[string][]byte, len(authCfg.TokenSigningKeys))
+	for _, key := range authCfg.TokenSigningKeys {
+		keys[key.ID] = []byte(key.Secret)
+	}
+
+	return token.NewSigner(authCfg.TokenSigningKeys[0].ID, keys)
+}
+
+// signSessionTokens replaces the opaque access token with a signed one in the
+// signed token mode.
+func (a *API) signSessionTokens(tokens types.SessionTokens) (types.SessionTokens, error) {
+	if a.tokenSigner == nil {
+		return tokens, nil
+	}
+
+	accessToken, err := a.tokenSigner.Issue(token.Claims{
+		UserID:    tokens.UserID,
+		SessionID: tokens.SessionID,
+		Scopes:    sessionScopes,
+		IssuedAt:  time.Now(),
+		ExpiresAt: tokens.ExpiresAt,
+	})
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	tokens.AccessToken = accessToken
+
+	return tokens, nil
+}
+
+// verifySignedToken authorizes a request with a signed access token.
+func (a *API) verifySignedToken(accessToken string) (*authContext, error) {
+	claims, err := a.tokenSigner.Verify(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if a.revokedSessions.contains(claims.SessionID) {
+		return nil, token.ErrInvalidToken
+	}
+
+	return &authContext{userID: claims.UserID, sessionID: claims.SessionID, scopes: claims.Scopes}, nil
+}
+
+// reloadRevokedSessions refreshes the revocation list from the database.
+func (a *API) reloadRevokedSessions(ctx context.Context) error {
+	if a.tokenSigner == nil {
+		return nil
+	}
+
+	sessionIDs, err := a.userStorage.ListRevokedSessions(ctx)
+	if err != nil {
+		return err
+	}
+	a.revokedSessions.set(sessionIDs)
+
+	return nil
+}
+
+func (a *API) keepRevokedSessionsFresh(ctx context.Context) {
+	ticker := time.NewTicker(revokedSessionsReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.reloadRevokedSessions(ctx); err != nil {
+				log.Printf("Failed to reload revoked sessions: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
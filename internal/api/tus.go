@@ -0,0 +1,314 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// Resumable uploads following the tus 1.0 protocol (https://tus.io) with the
+// creation, expiration and termination extensions. An upload is created with
+// POST /api/tus/, its bytes are sent with PATCH /api/tus/{id} and the asset
+// appears once the last byte has been received. The org and owner query
+// parameters of the POST select the namespace like for other uploads and
+// are carried over into the upload URL.
+const (
+	tusVersion      = "1.0.0"
+	tusExtensions   = "creation,expiration,termination"
+	tusPathPrefix   = "/api/tus/"
+	tusOctetStream  = "application/offset+octet-stream"
+	tusMetadataName = "name"
+	tusMetadataFile = "filename"
+	tusMetadataType = "filetype"
+)
+
+func (a *API) tusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(MAX_UPLOAD_SIZE, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireScope(w, auth, types.ScopeAssetsWrite) {
+		return
+	}
+	userID := auth.userID
+
+	uploadID := strings.TrimPrefix(r.URL.Path, tusPathPrefix)
+	if uploadID == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleCreateUpload(w, r, userID)
+		return
+	}
+
+	if r.Method != http.MethodHead && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespaceID, ok := a.resolveUploadNamespace(w, r, userID, uploadID)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		a.handleGetUploadOffset(w, r, namespaceID, uploadID)
+	case http.MethodPatch:
+		a.handleWriteUploadChunk(w, r, namespaceID, uploadID)
+	case http.MethodDelete:
+		a.handleDeleteUpload(w, r, namespaceID, uploadID)
+	}
+}
+
+// resolveUploadNamespace checks the caller's write access to the namespace
+// selected by the org or owner query parameter for an existing upload. A
+// grant from another user is checked against the asset name of the upload.
+func (a *API) resolveUploadNamespace(w http.ResponseWriter, r *http.Request, userID int64, uploadID string) (int64, bool) {
+	query := r.URL.Query()
+	if query.Get(orgParam) == "" && query.Get(ownerParam) == "" {
+		return userID, true
+	}
+
+	var assetName string
+	if query.Get(ownerParam) != "" {
+		var err error
+		assetName, err = a.assetStorage.GetUploadAssetName(r.Context(), uploadID)
+		if err != nil {
+			if errors.Is(err, storage.ErrUploadNotFound) {
+				http.Error(w, "Upload not found", http.StatusNotFound)
+			} else {
+				log.Printf("storage.GetUploadAssetName error: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return 0, false
+		}
+	}
+
+	return a.resolveNamespace(w, r, userID, assetName, true)
+}
+
+func (a *API) handleCreateUpload(w http.ResponseWriter, r *http.Request, userID int64) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Upload-Defer-Length is not supported", http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if length > MAX_UPLOAD_SIZE {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+
+	assetName := metadata[tusMetadataName]
+	if assetName == "" {
+		assetName = metadata[tusMetadataFile]
+	}
+	if assetName == "" {
+		http.Error(w, "Name is empty", http.StatusBadRequest)
+		return
+	}
+
+	namespaceID, ok := a.resolveNamespace(w, r, userID, assetName, true)
+	if !ok {
+		return
+	}
+
+	contentType := metadata[tusMetadataType]
+	if contentType == "" {
+		contentType = defaultMediaType
+	}
+
+	upload, err := a.assetStorage.CreateUpload(r.Context(), types.Upload{
+		UserID:       namespaceID,
+		AssetName:    assetName,
+		OriginalName: metadata[tusMetadataFile],
+		ContentType:  contentType,
+		Length:       length,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrAssetAlreadyExists) {
+			http.Error(w, "Asset already exists", http.StatusConflict)
+		} else {
+			log.Printf("storage.CreateUpload error: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	location := tusPathPrefix + upload.ID
+	if namespace := uploadNamespaceQuery(r); namespace != "" {
+		location += "?" + namespace
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *API) handleGetUploadOffset(w http.ResponseWriter, r *http.Request, userID int64, uploadID string) {
+	upload, err := a.assetStorage.GetUpload(r.Context(), userID, uploadID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUploadNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			log.Printf("storage.GetUpload error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *API) handleWriteUploadChunk(w http.ResponseWriter, r *http.Request, userID int64, uploadID string) {
+	if r.Header.Get("Content-Type") != tusOctetStream {
+		http.Error(w, "Invalid Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	if r.ContentLength > MAX_UPLOAD_SIZE {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body := &resumableBody{r: http.MaxBytesReader(w, r.Body, MAX_UPLOAD_SIZE)}
+
+	upload, err := a.assetStorage.WriteUploadChunk(r.Context(), userID, uploadID, offset, body)
+	if err != nil {
+		if errors.Is(err, storage.ErrUploadNotFound) {
+			http.Error(w, "Upload not found", http.StatusNotFound)
+		} else if errors.Is(err, storage.ErrUploadOffsetMismatch) {
+			http.Error(w, "Upload-Offset mismatch", http.StatusConflict)
+		} else if errors.Is(err, storage.ErrAssetAlreadyExists) {
+			http.Error(w, "Asset already exists", http.StatusConflict)
+		} else {
+			log.Printf("storage.WriteUploadChunk error: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if body.err != nil {
+		log.Printf("Upload %s interrupted at offset %d: %v", uploadID, upload.Offset, body.err)
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleDeleteUpload(w http.ResponseWriter, r *http.Request, userID int64, uploadID string) {
+	err := a.assetStorage.DeleteUpload(r.Context(), userID, uploadID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUploadNotFound) {
+			http.Error(w, "Upload not found", http.StatusNotFound)
+		} else {
+			log.Printf("storage.DeleteUpload error: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadNamespaceQuery returns the org and owner query parameters of the
+// request, encoded for the upload URL.
+func uploadNamespaceQuery(r *http.Request) string {
+	query := r.URL.Query()
+	namespace := url.Values{}
+	for _, param := range []string{orgParam, ownerParam} {
+		if value := query.Get(param); value != "" {
+			namespace.Set(param, value)
+		}
+	}
+	return namespace.Encode()
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated pairs
+// of a key and an optional base64 encoded value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encodedValue, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encodedValue)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+// resumableBody ends the stream on a read error instead of failing it, so the
+// bytes received before a connection dropped are kept and the client can
+// resume from there.
+type resumableBody struct {
+	r   io.Reader
+	err error
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/storage"
+	"github.com/ArturV19/file-storage/internal/totp"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// Two-factor authentication with TOTP codes:
+//
+//	POST /api/2fa/enroll    start enrollment, returns the secret and the otpauth:// URI
+//	POST /api/2fa/confirm   {"code": "123456"}, enables 2FA and returns the recovery codes once
+//	POST /api/2fa/disable   {"password": "...", "code": "123456"}
+//
+// With 2FA enabled /api/auth answers {"two_factor_required": true,
+// "challenge_token": "..."} and the login is finished with
+//
+//	POST /api/auth/2fa      {"challenge_token": "...", "code": "123456"}
+//
+// where the code may also be one of the recovery codes, each usable once.
+// 2FA is managed with session tokens only.
+const (
+	twoFactorLoginPath  = "/api/auth/2fa"
+	twoFactorPathPrefix = "/api/2fa/"
+	totpIssuer          = "file-storage"
+)
+
+func (a *API) twoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req dto.CompleteTwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	if req.ChallengeToken == "" || req.Code == "" {
+		http.Error(w, "Empty challenge token or code", http.StatusBadRequest)
+		return
+	}
+
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid IP address", http.StatusInternalServerError)
+		return
+	}
+
+	authData := types.AuthData{
+		IPAddress: ipAddress,
+		UserAgent: r.UserAgent(),
+	}
+
+	tokens, err := a.userStorage.CompleteTwoFactorLogin(r.Context(), req.ChallengeToken, req.Code, authData)
+	if err != nil {
+		var throttled *storage.LoginThrottledError
+		if errors.Is(err, storage.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		} else if errors.Is(err, storage.ErrInvalidTwoFactorCode) {
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+		} else if errors.As(err, &throttled) {
+			writeLoginThrottled(w, throttled)
+		} else {
+			log.Printf("storage.CompleteTwoFactorLogin error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	a.writeSessionTokens(w, tokens)
+}
+
+func (a *API) twoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth, err := a.authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !requireSession(w, auth) {
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, twoFactorPathPrefix) {
+	case "enroll":
+		a.handleEnrollTOTP(w, r, auth.userID)
+	case "confirm":
+		a.handleConfirmTOTP(w, r, auth.userID)
+	case "disable":
+		a.handleDisableTOTP(w, r, auth.userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *API) handleEnrollTOTP(w http.ResponseWriter, r *http.Request, userID int64) {
+	secret, login, err := a.userStorage.EnrollTOTP(r.Context(), userID)
+	if err != nil {
+		writeTwoFactorError(w, "storage.EnrollTOTP", err)
+		return
+	}
+
+	resp := dto.EnrollTOTPResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(totpIssuer, login, secret),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleConfirmTOTP(w http.ResponseWriter, r *http.Request, userID int64) {
+	var req dto.ConfirmTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" {
+		http.Error(w, "Empty code", http.StatusBadRequest)
+		return
+	}
+
+	recoveryCodes, err := a.userStorage.ConfirmTOTP(r.Context(), userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, "storage.ConfirmTOTP", err)
+		return
+	}
+
+	resp := dto.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handleDisableTOTP(w http.ResponseWriter, r *http.Request, userID int64) {
+	var req dto.DisableTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Password == "" || req.Code == "" {
+		http.Error(w, "Empty password or code", http.StatusBadRequest)
+		return
+	}
+
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid IP address", http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.userStorage.DisableTOTP(r.Context(), userID, req.Password, req.Code, ipAddress); err != nil {
+		writeTwoFactorError(w, "storage.DisableTOTP", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTwoFactorError(w http.ResponseWriter, op string, err error) {
+	var throttled *storage.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		writeLoginThrottled(w, throttled)
+	case errors.Is(err, storage.ErrInvalidTwoFactorCode):
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+	case errors.Is(err, storage.ErrInvalidLoginPassword):
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+	case errors.Is(err, storage.ErrTwoFactorAlreadyEnabled):
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+	case errors.Is(err, storage.ErrTwoFactorNotEnabled):
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+	case errors.Is(err, storage.ErrTwoFactorNotEnrolled):
+		http.Error(w, "Two-factor authentication enrollment is not started", http.StatusConflict)
+	default:
+		log.Printf("%s error: %v", op, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeTwoFactorRequired(w http.ResponseWriter, challengeToken string) {
+	resp := dto.TwoFactorRequiredResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
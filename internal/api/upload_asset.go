@@ -1,6 +1,8 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
@@ -10,33 +12,53 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/ArturV19/file-storage/internal/dto"
 	"github.com/ArturV19/file-storage/internal/storage"
 	"github.com/ArturV19/file-storage/internal/types"
 )
 
 const MAX_UPLOAD_SIZE = 1 * 1024 * 1024 * 1024 // 1GB
 
+const defaultMediaType = "application/octet-stream"
+
+// contentSHA256Header announces the hex SHA-256 of the asset content. Content
+// that is already stored is then verified without being written again.
+const contentSHA256Header = "X-Content-SHA256"
+
+// UploadAssetHandler creates an asset with POST. PUT also replaces an
+// existing asset. Both honor If-Match and If-None-Match.
 func (a *API) UploadAssetHandler(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token := strings.TrimPrefix(authHeader, "Bearer ")
 	assetName := strings.TrimPrefix(r.URL.Path, "/api/upload-asset/")
 	if assetName == "" {
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	userID, err := a.userStorage.ValidateToken(r.Context(), token)
+	auth, err := a.authorize(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireScope(w, auth, types.ScopeAssetsWrite) {
+		return
+	}
+
+	namespaceID, ok := a.resolveNamespace(w, r, auth.userID, assetName, true)
+	if !ok {
+		return
+	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_SIZE)
+	maxUploadSize := int64(MAX_UPLOAD_SIZE)
+	if auth.presigned != nil && auth.presigned.maxSize > 0 {
+		maxUploadSize = auth.presigned.maxSize
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
@@ -44,11 +66,19 @@ func (a *API) UploadAssetHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}(r.Body)
 
-	if r.ContentLength > MAX_UPLOAD_SIZE {
+	if r.ContentLength > maxUploadSize {
 		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
 		return
 	}
 
+	contentSHA256 := strings.ToLower(r.Header.Get(contentSHA256Header))
+	if contentSHA256 != "" {
+		if digest, err := hex.DecodeString(contentSHA256); err != nil || len(digest) != sha256.Size {
+			http.Error(w, "Invalid "+contentSHA256Header, http.StatusBadRequest)
+			return
+		}
+	}
+
 	contentType := r.Header.Get("Content-Type")
 	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
@@ -63,47 +93,100 @@ func (a *API) UploadAssetHandler(w http.ResponseWriter, r *http.Request) {
 		originalName = ""
 		body = r.Body
 	} else {
-		file, header, err := r.FormFile("file")
+		// The multipart body is read part by part straight from the request so
+		// the file is never buffered in memory or spooled to a temporary file.
+		part, err := nextFilePart(r)
 		if err != nil {
 			http.Error(w, "Invalid file", http.StatusBadRequest)
 			return
 		}
-		defer func(file multipart.File) {
-			err := file.Close()
+		defer func(part *multipart.Part) {
+			err := part.Close()
 			if err != nil {
-				http.Error(w, "File close error", http.StatusInternalServerError)
-				return
+				log.Printf("Error closing multipart part: %v", err)
+			}
+		}(part)
+
+		originalName = part.FileName()
+		mediaType = defaultMediaType
+		if partContentType := part.Header.Get("Content-Type"); partContentType != "" {
+			if partMediaType, _, err := mime.ParseMediaType(partContentType); err == nil {
+				mediaType = partMediaType
 			}
-		}(file)
+		}
+		body = part
+	}
 
-		originalName = header.Filename
-		body = file
+	if auth.presigned != nil && auth.presigned.contentType != "" && auth.presigned.contentType != mediaType {
+		http.Error(w, "Content-Type not allowed by signature", http.StatusForbidden)
+		return
 	}
 
 	uploadAssetData := types.UploadAssetData{
-		UserID:       userID,
+		UserID:       namespaceID,
 		AssetName:    assetName,
 		OriginalName: originalName,
 		ContentType:  mediaType,
 		Body:         body,
+		Overwrite:    r.Method == http.MethodPut,
+		Precondition: assetPrecondition(r),
+		SHA256:       contentSHA256,
 	}
 
-	err = a.assetStorage.UploadAsset(r.Context(), uploadAssetData)
+	asset, err := a.assetStorage.UploadAsset(r.Context(), uploadAssetData)
 	if err != nil {
 		if errors.Is(err, storage.ErrAssetAlreadyExists) {
 			http.Error(w, "Asset already exists", http.StatusConflict)
-		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+		} else if errors.Is(err, errPreconditionFailed) {
+			http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		} else if errors.Is(err, storage.ErrDigestMismatch) {
+			http.Error(w, contentSHA256Header+" does not match the content", http.StatusBadRequest)
+		} else if isBodyTooLarge(err) {
 			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
 		} else {
+			log.Printf("storage.UploadAsset error: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 		return
 	}
 
+	resp := dto.UploadAssetResponse{
+		Status:  "ok",
+		Version: asset.Version,
+		Size:    asset.Size,
+		ETag:    asset.ETag,
+	}
+	w.Header().Set("ETag", formatETag(asset.ETag))
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	err = json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		log.Printf("Error encoding response: %v", err)
 		return
 	}
 }
+
+// nextFilePart advances the multipart reader to the "file" form field.
+func nextFilePart(r *http.Request) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		if err := part.Close(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ArturV19/file-storage/internal/dto"
+	"github.com/ArturV19/file-storage/internal/validation"
+)
+
+// writeValidationErrors writes a 400 response listing the errors and returns
+// false if there are any.
+func writeValidationErrors(w http.ResponseWriter, errs []validation.FieldError) bool {
+	if len(errs) == 0 {
+		return true
+	}
+
+	resp := dto.ValidationErrorResponse{
+		Errors: make([]dto.FieldError, 0, len(errs)),
+	}
+	for _, err := range errs {
+		resp.Errors = append(resp.Errors, dto.FieldError{
+			Field:   err.Field,
+			Code:    err.Code,
+			Message: err.Message,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
+}
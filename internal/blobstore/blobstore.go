@@ -0,0 +1,34 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// copyChunkSize bounds the memory used per Put: content is copied into the
+// backend in chunks of this size.
+const copyChunkSize = 1 * 1024 * 1024 // 1MB
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps asset bytes. Metadata lives in Postgres and refers to blobs by
+// the key returned from Put.
+type Store interface {
+	// Put streams r into a new blob and returns its key and size.
+	Put(ctx context.Context, r io.Reader) (string, int64, error)
+	// Open returns the blob content. The caller must close it.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+func generateKey() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,114 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const tmpDirName = "tmp"
+
+var localKeyPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Local keeps blobs as files in a directory. Files are written to a temporary
+// file first and renamed into place, so a blob is either complete or absent.
+// Blobs are sharded into two levels of subdirectories by key prefix to keep
+// directories small: <dir>/ab/cd/abcd...
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if dir == "" {
+		return nil, errors.New("local blob store directory is empty")
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, tmpDirName), 0o750); err != nil {
+		return nil, fmt.Errorf("create local blob store directory: %w", err)
+	}
+
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) Put(_ context.Context, r io.Reader) (string, int64, error) {
+	key, err := generateKey()
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Join(l.dir, tmpDirName), key+"-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			if errRemove := os.Remove(tmpFile.Name()); errRemove != nil && !errors.Is(errRemove, fs.ErrNotExist) {
+				log.Printf("blobstore.Local.Put remove temp file error: %v", errRemove)
+			}
+		}
+	}()
+
+	size, err := io.CopyBuffer(tmpFile, r, make([]byte, copyChunkSize))
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err = tmpFile.Sync(); err != nil {
+		return "", 0, err
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return "", 0, err
+	}
+
+	path := l.path(key)
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", 0, err
+	}
+
+	if err = os.Rename(tmpFile.Name(), path); err != nil {
+		return "", 0, err
+	}
+
+	return key, size, nil
+}
+
+func (l *Local) Open(_ context.Context, key string) (io.ReadSeekCloser, error) {
+	if !localKeyPattern.MatchString(key) {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(l.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	if !localKeyPattern.MatchString(key) {
+		return nil
+	}
+
+	err := os.Remove(l.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.dir, key[0:2], key[2:4], key)
+}
@@ -0,0 +1,172 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Postgres keeps blobs as large objects in the metadata database. Keys are
+// large object OIDs.
+type Postgres struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgres(db *pgxpool.Pool) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Put(ctx context.Context, r io.Reader) (string, int64, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("blobstore.Postgres.Put tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	largeObjects := tx.LargeObjects()
+	oid, err := largeObjects.Create(ctx, 0)
+	if err != nil {
+		return "", 0, err
+	}
+
+	largeObject, err := largeObjects.Open(ctx, oid, pgx.LargeObjectModeWrite)
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := io.CopyBuffer(largeObject, r, make([]byte, copyChunkSize))
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err = largeObject.Close(); err != nil {
+		return "", 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", 0, err
+	}
+
+	return strconv.FormatUint(uint64(oid), 10), size, nil
+}
+
+// Open returns a reader that fetches the large object in chunks with
+// lo_get. Every chunk is a separate short query, so a slow download holds
+// neither a pooled connection nor a transaction between reads.
+func (p *Postgres) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	oid, err := parseOID(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// The descriptor only lives for the implicit transaction of the statement.
+	var size int64
+	err = p.db.QueryRow(ctx, "SELECT lo_lseek64(lo_open($1, $2), 0, 2)", oid, inventoryRead).Scan(&size)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.UndefinedObject {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &largeObjectReader{ctx: ctx, db: p.db, oid: oid, size: size}, nil
+}
+
+func (p *Postgres) Delete(ctx context.Context, key string) error {
+	oid, err := parseOID(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(ctx, "SELECT lo_unlink(oid) FROM pg_largeobject_metadata WHERE oid = $1", oid)
+	return err
+}
+
+func parseOID(key string) (uint32, error) {
+	oid, err := strconv.ParseUint(key, 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid large object key: " + key)
+	}
+	return uint32(oid), nil
+}
+
+// inventoryRead is INV_READ from libpq-fs.h.
+const inventoryRead = 0x40000
+
+// largeObjectReader reads a large object through lo_get, buffering up to
+// copyChunkSize bytes per query.
+type largeObjectReader struct {
+	ctx    context.Context
+	db     *pgxpool.Pool
+	oid    uint32
+	size   int64
+	offset int64
+
+	buf       []byte
+	bufOffset int64
+}
+
+func (r *largeObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.offset < r.bufOffset || r.offset >= r.bufOffset+int64(len(r.buf)) {
+		length := int64(copyChunkSize)
+		if remaining := r.size - r.offset; remaining < length {
+			length = remaining
+		}
+
+		var chunk []byte
+		err := r.db.QueryRow(r.ctx, "SELECT lo_get($1, $2, $3)", r.oid, r.offset, int32(length)).Scan(&chunk)
+		if err != nil {
+			if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.UndefinedObject {
+				return 0, ErrNotFound
+			}
+			return 0, err
+		}
+		if len(chunk) == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.buf, r.bufOffset = chunk, r.offset
+	}
+
+	n := copy(p, r.buf[r.offset-r.bufOffset:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *largeObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("blobstore: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("blobstore: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *largeObjectReader) Close() error {
+	r.buf = nil
+	return nil
+}
@@ -0,0 +1,192 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// minS3PartSize is the smallest part size S3 accepts for multipart uploads.
+const minS3PartSize = 5 * 1024 * 1024 // 5MB
+
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// PartSize is the size of a single part of a multipart upload. Bodies
+	// smaller than one part are uploaded with a single request.
+	PartSize int64
+}
+
+// S3 keeps blobs as objects in an S3-compatible bucket.
+type S3 struct {
+	client   minio.Core
+	bucket   string
+	partSize int64
+}
+
+func NewS3(ctx context.Context, opts S3Options) (*S3, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+	if opts.PartSize < minS3PartSize {
+		return nil, fmt.Errorf("s3 part size must be at least %d bytes", minS3PartSize)
+	}
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check s3 bucket: %w", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, fmt.Errorf("create s3 bucket: %w", err)
+		}
+	}
+
+	return &S3{client: minio.Core{Client: client}, bucket: opts.Bucket, partSize: opts.PartSize}, nil
+}
+
+// Put buffers at most one part: the buffer grows with the body, so a body
+// that fits into a single part is sent with one PUT and allocates no more
+// than its size. Anything larger is sent as a multipart upload that reuses
+// the same buffer for every part.
+func (s *S3) Put(ctx context.Context, r io.Reader) (string, int64, error) {
+	key, err := generateKey()
+	if err != nil {
+		return "", 0, err
+	}
+
+	firstPart, err := readPart(r, s.partSize)
+	if err != nil {
+		return "", 0, err
+	}
+
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+
+	if int64(len(firstPart)) < s.partSize {
+		info, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(firstPart), int64(len(firstPart)), "", "", opts)
+		if err != nil {
+			return "", 0, err
+		}
+		return key, info.Size, nil
+	}
+
+	size, err := s.putMultipart(ctx, key, firstPart, r, opts)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return key, size, nil
+}
+
+// putMultipart uploads part, which holds the first full part, followed by
+// the rest of r. The backing array of part is reused for the following parts.
+func (s *S3) putMultipart(ctx context.Context, key string, part []byte, r io.Reader, opts minio.PutObjectOptions) (size int64, err error) {
+	uploadID, err := s.client.NewMultipartUpload(ctx, s.bucket, key, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if errAbort := s.client.AbortMultipartUpload(context.WithoutCancel(ctx), s.bucket, key, uploadID); errAbort != nil {
+				log.Printf("blobstore.S3.Put AbortMultipartUpload error: %v", errAbort)
+			}
+		}
+	}()
+
+	var parts []minio.CompletePart
+	for partNumber := 1; len(part) > 0; partNumber++ {
+		uploaded, err := s.client.PutObjectPart(ctx, s.bucket, key, uploadID, partNumber, bytes.NewReader(part), int64(len(part)), minio.PutObjectPartOptions{})
+		if err != nil {
+			return 0, err
+		}
+		parts = append(parts, minio.CompletePart{PartNumber: partNumber, ETag: uploaded.ETag})
+		size += int64(len(part))
+
+		n, err := io.ReadFull(r, part[:s.partSize])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		part = part[:n]
+	}
+
+	if _, err = s.client.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, parts, opts); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// readPart reads up to partSize bytes from r into a buffer that doubles from
+// copyChunkSize as the data arrives and never grows beyond partSize.
+func readPart(r io.Reader, partSize int64) ([]byte, error) {
+	part := make([]byte, 0, min(partSize, copyChunkSize))
+	for int64(len(part)) < partSize {
+		if len(part) == cap(part) {
+			grown := make([]byte, len(part), min(partSize, 2*int64(cap(part))))
+			copy(grown, part)
+			part = grown
+		}
+
+		n, err := r.Read(part[len(part):cap(part)])
+		part = part[:len(part)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return part, nil
+}
+
+// Open returns the object without downloading it. Reads after a Seek are
+// served with ranged GET requests.
+func (s *S3) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	object, err := s.client.Client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if isS3NotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil && !isS3NotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func isS3NotFound(err error) bool {
+	errResp := minio.ToErrorResponse(err)
+	return errResp.StatusCode == http.StatusNotFound || errResp.Code == "NoSuchKey"
+}
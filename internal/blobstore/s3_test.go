@@ -0,0 +1,416 @@
+package blobstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 implements the subset of the S3 API used by the S3 store, with
+// path-style addressing and without signature checks.
+type fakeS3 struct {
+	mu       sync.Mutex
+	buckets  map[string]bool
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	nextID   int
+	requests []string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		buckets: make(map[string]bool),
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	operation := r.Method
+	switch {
+	case query.Has("uploads"):
+		operation += " uploads"
+	case query.Has("partNumber"):
+		operation += " part"
+	case query.Has("uploadId"):
+		operation += " upload"
+	}
+	if key == "" {
+		operation += " bucket"
+	}
+	f.requests = append(f.requests, operation)
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !f.buckets[bucket] {
+				writeFakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+			}
+		case http.MethodPut:
+			f.buckets[bucket] = true
+		default:
+			writeFakeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+
+	if !f.buckets[bucket] {
+		writeFakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch operation {
+	case http.MethodPut:
+		body, err := readFakeS3Body(r)
+		if err != nil {
+			writeFakeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = body
+		w.Header().Set("ETag", `"`+strconv.Itoa(len(body))+`"`)
+
+	case http.MethodPost + " uploads":
+		f.nextID++
+		uploadID := strconv.Itoa(f.nextID)
+		f.uploads[uploadID] = make(map[int][]byte)
+		writeFakeS3XML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: uploadID})
+
+	case http.MethodPut + " part":
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		body, err := readFakeS3Body(r)
+		if err != nil {
+			writeFakeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, partNumber))
+
+	case http.MethodPost + " upload":
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			writeFakeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var object []byte
+		for i, part := range complete.Parts {
+			body, ok := parts[part.PartNumber]
+			if !ok || part.PartNumber != i+1 || strings.Trim(part.ETag, `"`) != fmt.Sprintf("part-%d", part.PartNumber) {
+				writeFakeS3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			object = append(object, body...)
+		}
+		delete(f.uploads, query.Get("uploadId"))
+		f.objects[key] = object
+		writeFakeS3XML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: `"multipart"`})
+
+	case http.MethodDelete + " upload":
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"`+strconv.Itoa(len(object))+`"`)
+		http.ServeContent(w, r, key, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(object))
+
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeFakeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) takeRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	requests := f.requests
+	f.requests = nil
+	return requests
+}
+
+// readFakeS3Body decodes the aws-chunked encoding used for streaming
+// signatures.
+func readFakeS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var body []byte
+	reader := bufio.NewReader(r.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return body, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk[:size]...)
+	}
+}
+
+func writeFakeS3XML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		panic(err)
+	}
+}
+
+func writeFakeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3(context.Background(), S3Options{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    "assets",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PartSize:  minS3PartSize,
+	})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	fake.takeRequests()
+
+	return store, fake
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func TestNewS3CreatesBucket(t *testing.T) {
+	_, fake := newTestS3(t)
+
+	if !fake.buckets["assets"] {
+		t.Fatal("bucket was not created")
+	}
+}
+
+func TestS3PutSinglePart(t *testing.T) {
+	store, fake := newTestS3(t)
+	content := testContent(1000)
+
+	key, size, err := store.Put(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Fatalf("size = %d, want %d", size, len(content))
+	}
+	if requests := fake.takeRequests(); len(requests) != 1 || requests[0] != http.MethodPut {
+		t.Fatalf("requests = %v, want a single PUT", requests)
+	}
+	if !bytes.Equal(fake.objects[key], content) {
+		t.Fatal("stored object differs from the content")
+	}
+}
+
+func TestS3PutMultipart(t *testing.T) {
+	store, fake := newTestS3(t)
+	content := testContent(2*minS3PartSize + 12345)
+
+	key, size, err := store.Put(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Fatalf("size = %d, want %d", size, len(content))
+	}
+
+	want := []string{"POST uploads", "PUT part", "PUT part", "PUT part", "POST upload"}
+	if requests := fake.takeRequests(); strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Fatalf("requests = %v, want %v", requests, want)
+	}
+	if !bytes.Equal(fake.objects[key], content) {
+		t.Fatal("stored object differs from the content")
+	}
+}
+
+func TestS3PutExactlyOnePart(t *testing.T) {
+	store, fake := newTestS3(t)
+	content := testContent(minS3PartSize)
+
+	key, _, err := store.Put(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	want := []string{"POST uploads", "PUT part", "POST upload"}
+	if requests := fake.takeRequests(); strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Fatalf("requests = %v, want %v", requests, want)
+	}
+	if !bytes.Equal(fake.objects[key], content) {
+		t.Fatal("stored object differs from the content")
+	}
+}
+
+func TestS3PutAbortsOnReadError(t *testing.T) {
+	store, fake := newTestS3(t)
+	errRead := errors.New("read failed")
+	body := io.MultiReader(bytes.NewReader(testContent(minS3PartSize+1)), &failingReader{err: errRead})
+
+	if _, _, err := store.Put(context.Background(), body); !errors.Is(err, errRead) {
+		t.Fatalf("Put error = %v, want %v", err, errRead)
+	}
+	if len(fake.uploads) != 0 {
+		t.Fatalf("%d multipart uploads left behind", len(fake.uploads))
+	}
+	if len(fake.objects) != 0 {
+		t.Fatalf("%d objects stored", len(fake.objects))
+	}
+}
+
+func TestS3OpenSeek(t *testing.T) {
+	store, _ := newTestS3(t)
+	content := testContent(100000)
+
+	key, _, err := store.Put(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	blob, err := store.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer blob.Close()
+
+	if _, err := blob.Seek(90000, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, content[90000:]) {
+		t.Fatal("read after Seek differs from the content")
+	}
+}
+
+func TestS3OpenMissing(t *testing.T) {
+	store, _ := newTestS3(t)
+
+	if _, err := store.Open(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestS3Delete(t *testing.T) {
+	store, fake := newTestS3(t)
+
+	key, _, err := store.Put(context.Background(), strings.NewReader("content"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Delete(context.Background(), key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.objects[key]; ok {
+		t.Fatal("object was not deleted")
+	}
+	if err := store.Delete(context.Background(), key); err != nil {
+		t.Fatalf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestReadPartGrowsUpToPartSize(t *testing.T) {
+	part, err := readPart(bytes.NewReader(testContent(3*copyChunkSize)), 2*copyChunkSize+1)
+	if err != nil {
+		t.Fatalf("readPart: %v", err)
+	}
+	if len(part) != 2*copyChunkSize+1 {
+		t.Fatalf("len = %d, want %d", len(part), 2*copyChunkSize+1)
+	}
+	if cap(part) != 2*copyChunkSize+1 {
+		t.Fatalf("cap = %d, want the part size", cap(part))
+	}
+
+	part, err = readPart(strings.NewReader("small"), minS3PartSize)
+	if err != nil {
+		t.Fatalf("readPart: %v", err)
+	}
+	if string(part) != "small" || cap(part) > copyChunkSize {
+		t.Fatalf("part = %q with cap %d", part, cap(part))
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
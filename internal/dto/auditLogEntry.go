@@ -0,0 +1,12 @@
+package dto
+
+import "time"
+
+type AuditLogEntry struct {
+	ID        int64                  `json:"id"`
+	Admin     string                 `json:"admin"`
+	Action    string                 `json:"action"`
+	Target    string                 `json:"target,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
@@ -1,5 +1,8 @@
 package dto
 
 type AuthenticateUserResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the remaining lifetime of Token in seconds.
+	ExpiresIn int64 `json:"expires_in"`
 }
@@ -0,0 +1,10 @@
+package dto
+
+type CompleteMultipartUploadRequest struct {
+	Parts []CompletedPart `json:"parts"`
+}
+
+type CompletedPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+}
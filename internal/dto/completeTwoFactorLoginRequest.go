@@ -0,0 +1,7 @@
+package dto
+
+type CompleteTwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	// Code is a TOTP code or one of the recovery codes.
+	Code string `json:"code"`
+}
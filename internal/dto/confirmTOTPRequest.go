@@ -0,0 +1,5 @@
+package dto
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type ConfirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
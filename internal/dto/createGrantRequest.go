@@ -0,0 +1,11 @@
+package dto
+
+type CreateGrantRequest struct {
+	// Grantee is the login of the user that gets access.
+	Grantee   string `json:"grantee"`
+	AssetName string `json:"asset_name"`
+	// IsPrefix grants access to every asset whose name starts with
+	// AssetName.
+	IsPrefix   bool   `json:"is_prefix"`
+	Permission string `json:"permission"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+}
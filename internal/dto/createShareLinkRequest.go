@@ -0,0 +1,10 @@
+package dto
+
+type CreateShareLinkRequest struct {
+	AssetName string `json:"asset_name"`
+	Password  string `json:"password"`
+	// ExpiresIn is the link lifetime in seconds, 0 for a link that doesn't
+	// expire.
+	ExpiresIn    int64 `json:"expires_in"`
+	MaxDownloads *int  `json:"max_downloads"`
+}
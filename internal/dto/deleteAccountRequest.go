@@ -0,0 +1,6 @@
+package dto
+
+type DeleteAccountRequest struct {
+	// Password is required for users with a local password.
+	Password string `json:"password"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+type DisableTOTPRequest struct {
+	Password string `json:"password"`
+	// Code is a TOTP code or one of the recovery codes.
+	Code string `json:"code"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+import "github.com/ArturV19/file-storage/internal/types"
+
+type GetAssetVersionsResponse struct {
+	Name     string               `json:"name"`
+	Versions []types.AssetVersion `json:"versions"`
+}
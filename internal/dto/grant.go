@@ -0,0 +1,12 @@
+package dto
+
+import "time"
+
+type Grant struct {
+	ID         int64     `json:"id"`
+	Grantee    string    `json:"grantee"`
+	AssetName  string    `json:"asset_name"`
+	IsPrefix   bool      `json:"is_prefix"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,6 @@
+package dto
+
+type InitiateMultipartUploadRequest struct {
+	OriginalName string `json:"original_name"`
+	ContentType  string `json:"content_type"`
+}
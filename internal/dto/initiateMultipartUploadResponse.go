@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type InitiateMultipartUploadResponse struct {
+	UploadID  string    `json:"upload_id"`
+	AssetName string    `json:"asset_name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type ListAPIKeysResponse struct {
+	APIKeys []APIKey `json:"api_keys"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type ListAuditLogResponse struct {
+	Entries []AuditLogEntry `json:"entries"`
+}
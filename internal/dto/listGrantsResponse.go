@@ -0,0 +1,5 @@
+package dto
+
+type ListGrantsResponse struct {
+	Grants []Grant `json:"grants"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type ListLoginLockoutsResponse struct {
+	Lockouts []LoginLockout `json:"lockouts"`
+}
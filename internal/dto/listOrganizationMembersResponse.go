@@ -0,0 +1,5 @@
+package dto
+
+type ListOrganizationMembersResponse struct {
+	Members []OrganizationMember `json:"members"`
+}
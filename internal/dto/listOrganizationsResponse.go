@@ -0,0 +1,5 @@
+package dto
+
+type ListOrganizationsResponse struct {
+	Organizations []Organization `json:"organizations"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type ListSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
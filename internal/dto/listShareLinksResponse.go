@@ -0,0 +1,5 @@
+package dto
+
+type ListShareLinksResponse struct {
+	ShareLinks []ShareLink `json:"share_links"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+import "github.com/ArturV19/file-storage/internal/types"
+
+type ListUploadPartsResponse struct {
+	UploadID string             `json:"upload_id"`
+	Parts    []types.UploadPart `json:"parts"`
+}
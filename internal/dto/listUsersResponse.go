@@ -0,0 +1,5 @@
+package dto
+
+type ListUsersResponse struct {
+	Users []UserAccount `json:"users"`
+}
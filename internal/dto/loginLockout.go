@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+type LoginLockout struct {
+	Kind        string    `json:"kind"`
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type Organization struct {
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
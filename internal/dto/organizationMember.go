@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type OrganizationMember struct {
+	Login     string    `json:"login"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+type PresignRequest struct {
+	Method    string `json:"method"`
+	AssetName string `json:"asset_name"`
+	Version   int    `json:"version"`
+	// ExpiresIn is the URL lifetime in seconds.
+	ExpiresIn   int64  `json:"expires_in"`
+	MaxSize     int64  `json:"max_size"`
+	ContentType string `json:"content_type"`
+}
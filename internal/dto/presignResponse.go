@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type PresignResponse struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type RefreshSessionRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
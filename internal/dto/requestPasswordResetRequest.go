@@ -0,0 +1,5 @@
+package dto
+
+type RequestPasswordResetRequest struct {
+	Login string `json:"login"`
+}
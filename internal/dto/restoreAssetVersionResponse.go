@@ -0,0 +1,6 @@
+package dto
+
+type RestoreAssetVersionResponse struct {
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+}
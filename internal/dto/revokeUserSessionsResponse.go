@@ -0,0 +1,5 @@
+package dto
+
+type RevokeUserSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
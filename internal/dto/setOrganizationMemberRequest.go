@@ -0,0 +1,5 @@
+package dto
+
+type SetOrganizationMemberRequest struct {
+	Role string `json:"role"`
+}
@@ -0,0 +1,14 @@
+package dto
+
+import "time"
+
+type ShareLink struct {
+	ID            string     `json:"id"`
+	URL           string     `json:"url"`
+	AssetName     string     `json:"asset_name"`
+	HasPassword   bool       `json:"has_password"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	MaxDownloads  *int       `json:"max_downloads"`
+	DownloadCount int        `json:"download_count"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+// TwoFactorRequiredResponse is returned by /api/auth instead of the tokens
+// for users with two-factor authentication.
+type TwoFactorRequiredResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+// UpdateUserRequest changes the fields that are set and leaves the others
+// alone.
+type UpdateUserRequest struct {
+	Disabled *bool `json:"disabled"`
+	Admin    *bool `json:"admin"`
+}
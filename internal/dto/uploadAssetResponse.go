@@ -0,0 +1,8 @@
+package dto
+
+type UploadAssetResponse struct {
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+	Size    int64  `json:"size"`
+	ETag    string `json:"etag"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+type UploadPartResponse struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+import "time"
+
+type UserAccount struct {
+	Login            string     `json:"login"`
+	Admin            bool       `json:"admin"`
+	Disabled         bool       `json:"disabled"`
+	DisabledAt       *time.Time `json:"disabled_at,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	External         bool       `json:"external"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Assets           int64      `json:"assets"`
+	AssetVersions    int64      `json:"asset_versions"`
+	StorageBytes     int64      `json:"storage_bytes"`
+	ActiveSessions   int64      `json:"active_sessions"`
+}
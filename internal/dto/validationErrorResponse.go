@@ -0,0 +1,12 @@
+package dto
+
+// ValidationErrorResponse lists every rule a request breaks.
+type ValidationErrorResponse struct {
+	Errors []FieldError `json:"errors"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
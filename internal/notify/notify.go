@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ArturV19/file-storage/config"
+)
+
+// PasswordReset carries a password reset token to the user.
+type PasswordReset struct {
+	Login     string    `json:"login"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Notifier delivers messages to users. Users have no contact details here,
+// so the log and file notifiers leave the delivery to the operator; other
+// notifiers can look the user up elsewhere.
+type Notifier interface {
+	SendPasswordReset(ctx context.Context, reset PasswordReset) error
+}
+
+// New returns the configured notifier, or nil if notifications are
+// disabled.
+func New(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Backend {
+	case config.NotifierNone:
+		return nil, nil
+	case config.NotifierLog:
+		return LogNotifier{}, nil
+	case config.NotifierFile:
+		return NewFileNotifier(cfg.File), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.Backend)
+	}
+}
+
+// LogNotifier writes notifications to the service log, for local use only:
+// anyone reading the log can reset any password.
+type LogNotifier struct{}
+
+func (LogNotifier) SendPasswordReset(ctx context.Context, reset PasswordReset) error {
+	log.Printf("Password reset token for %q, valid until %s: %s", reset.Login, reset.ExpiresAt.Format(time.RFC3339), reset.Token)
+	return nil
+}
+
+// FileNotifier appends notifications to a file as JSON lines.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) SendPasswordReset(ctx context.Context, reset PasswordReset) error {
+	return n.append(struct {
+		Type string `json:"type"`
+		PasswordReset
+	}{Type: "password_reset", PasswordReset: reset})
+}
+
+func (n *FileNotifier) append(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
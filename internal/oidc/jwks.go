@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Keys are refetched after keySetMaxAge, and at most every
+// keySetMinRefreshInterval when a token names a key that isn't known yet,
+// which is how key rotations at the provider are picked up. A failed fetch
+// isn't retried for keySetMinRefreshInterval either.
+const (
+	keySetMaxAge             = 1 * time.Hour
+	keySetMinRefreshInterval = 1 * time.Minute
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet is a cached JSON Web Key Set of a provider. Concurrent lookups share
+// a single fetch, and the lock is never held while fetching.
+type KeySet struct {
+	issuer string
+	client *http.Client
+
+	mu        sync.Mutex
+	url       string
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// fetchErr is the error of the last fetch if it failed at failedAt.
+	fetchErr error
+	failedAt time.Time
+	// fetching is closed when the fetch in progress is done.
+	fetching chan struct{}
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func NewKeySet(url string, client *http.Client) *KeySet {
+	return &KeySet{url: url, client: client}
+}
+
+// NewIssuerKeySet returns the key set of the issuer, whose URL is discovered
+// on first use.
+func NewIssuerKeySet(issuer string, client *http.Client) *KeySet {
+	return &KeySet{issuer: issuer, client: client}
+}
+
+// key returns the public key with the ID, fetching the key set if it is
+// stale or doesn't contain the key. While the provider is unreachable cached
+// keys are used even if they are stale.
+func (k *KeySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for {
+		k.mu.Lock()
+		age := time.Since(k.fetchedAt)
+		key, ok := k.keys[kid]
+		if ok && age < keySetMaxAge {
+			k.mu.Unlock()
+			return key, nil
+		}
+		if !ok && k.keys != nil && age < keySetMinRefreshInterval {
+			k.mu.Unlock()
+			return nil, ErrUnknownKey
+		}
+		if k.fetchErr != nil && time.Since(k.failedAt) < keySetMinRefreshInterval {
+			err := k.fetchErr
+			k.mu.Unlock()
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+
+		if fetching := k.fetching; fetching != nil {
+			k.mu.Unlock()
+			select {
+			case <-fetching:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		fetching := make(chan struct{})
+		k.fetching = fetching
+		url := k.url
+		k.mu.Unlock()
+
+		// The fetch is shared, so it isn't canceled with the request that
+		// started it. The client's timeout bounds it.
+		url, keys, err := k.fetch(context.WithoutCancel(ctx), url)
+
+		k.mu.Lock()
+		if err != nil {
+			k.fetchErr = err
+			k.failedAt = time.Now()
+		} else {
+			k.url = url
+			k.keys = keys
+			k.fetchedAt = time.Now()
+			k.fetchErr = nil
+		}
+		k.fetching = nil
+		close(fetching)
+		k.mu.Unlock()
+	}
+}
+
+// fetch fetches the key set from the URL, which is discovered from the
+// issuer if it is empty, and returns the URL with the keys.
+func (k *KeySet) fetch(ctx context.Context, url string) (string, map[string]crypto.PublicKey, error) {
+	if url == "" {
+		m, err := discover(ctx, k.client, k.issuer)
+		if err != nil {
+			return "", nil, err
+		}
+		url = m.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, k.client, url, &set); err != nil {
+		return "", nil, fmt.Errorf("fetch key set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Keys of unsupported types are skipped, tokens signed with
+			// them fail verification.
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return url, keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,135 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ArturV19/file-storage/internal/oidc/oidctest"
+)
+
+// jwksServer serves the key set of a mock provider and counts the fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+	failing atomic.Bool
+	// release blocks fetches until it is closed, if set.
+	release chan struct{}
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+
+	idp, err := oidctest.NewProvider(oidctest.Config{Issuer: "http://idp.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		if s.release != nil {
+			<-s.release
+		}
+		if s.failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		r.URL.Path = "/jwks"
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestKeySetSharesConcurrentFetches(t *testing.T) {
+	server := newJWKSServer(t)
+	server.release = make(chan struct{})
+	keys := NewKeySet(server.URL, server.Client())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.key(context.Background(), oidctest.KeyID)
+			errs <- err
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(server.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches := server.fetches.Load(); fetches != 1 {
+		t.Fatalf("fetched the key set %d times, want 1", fetches)
+	}
+}
+
+func TestKeySetCachesFailures(t *testing.T) {
+	server := newJWKSServer(t)
+	server.failing.Store(true)
+	keys := NewKeySet(server.URL, server.Client())
+
+	for i := 0; i < 3; i++ {
+		if _, err := keys.key(context.Background(), oidctest.KeyID); err == nil {
+			t.Fatal("got a key from a failing provider")
+		}
+	}
+	if fetches := server.fetches.Load(); fetches != 1 {
+		t.Fatalf("fetched the key set %d times, want 1", fetches)
+	}
+}
+
+func TestKeySetKeepsStaleKeysWhileUnreachable(t *testing.T) {
+	server := newJWKSServer(t)
+	keys := NewKeySet(server.URL, server.Client())
+
+	if _, err := keys.key(context.Background(), oidctest.KeyID); err != nil {
+		t.Fatal(err)
+	}
+
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-2 * keySetMaxAge)
+	keys.mu.Unlock()
+	server.failing.Store(true)
+
+	for i := 0; i < 3; i++ {
+		if _, err := keys.key(context.Background(), oidctest.KeyID); err != nil {
+			t.Fatalf("stale key not used: %v", err)
+		}
+	}
+	if fetches := server.fetches.Load(); fetches != 2 {
+		t.Fatalf("fetched the key set %d times, want 2", fetches)
+	}
+
+	if _, err := keys.key(context.Background(), "other"); err == nil || errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("unknown key while unreachable: got %v, want the fetch error", err)
+	}
+}
+
+func TestKeySetRejectsUnknownKeyWithoutRefetching(t *testing.T) {
+	server := newJWKSServer(t)
+	keys := NewKeySet(server.URL, server.Client())
+
+	for i := 0; i < 3; i++ {
+		if _, err := keys.key(context.Background(), "other"); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("err = %v, want %v", err, ErrUnknownKey)
+		}
+	}
+	if fetches := server.fetches.Load(); fetches != 1 {
+		t.Fatalf("fetched the key set %d times, want 1", fetches)
+	}
+}
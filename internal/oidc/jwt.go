@@ -0,0 +1,210 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is tolerated between the provider's clock and ours.
+const clockSkew = 1 * time.Minute
+
+var ErrInvalidToken = errors.New("invalid token")
+var ErrExpiredToken = errors.New("token expired")
+
+// Claims are the registered claims of a JWT and the standard OpenID Connect
+// claims identifying the user. Raw holds every claim by name.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          Audience `json:"aud"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	NotBefore         int64    `json:"nbf"`
+	Nonce             string   `json:"nonce"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+
+	Raw map[string]interface{} `json:"-"`
+}
+
+// Audience is the aud claim, which is either a string or an array of
+// strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes returns the scopes granted to an access token, from the space
+// separated scope claim or the scp array claim.
+func (c Claims) Scopes() []string {
+	if scope, ok := c.Raw["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	scp, _ := c.Raw["scp"].([]interface{})
+	scopes := make([]string, 0, len(scp))
+	for _, s := range scp {
+		if scope, ok := s.(string); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// UnverifiedIssuer returns the iss claim of a JWT without verifying it, to
+// tell which verifier the token is for.
+func UnverifiedIssuer(rawToken string) string {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+// Verifier verifies JWTs signed by the keys of a provider and issued for an
+// audience.
+type Verifier struct {
+	Issuer   string
+	Audience string
+	Keys     *KeySet
+}
+
+// Verify checks the signature, issuer, audience and validity period of the
+// token and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, rawToken string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	hash, ok := signatureHashes[header.Alg]
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+
+	key, err := v.Keys.key(ctx, header.Kid)
+	if err != nil {
+		if errors.Is(err, ErrUnknownKey) {
+			return Claims{}, ErrInvalidToken
+		}
+		return Claims{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	digest := hash.New()
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, hash, digest.Sum(nil), signature) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if err := decodeSegment(parts[1], &claims.Raw); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if claims.Issuer != v.Issuer || !claims.Audience.Contains(v.Audience) || claims.Subject == "" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return Claims{}, ErrInvalidToken
+	}
+	if !now.Add(-clockSkew).Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Claims{}, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+}
+
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return false
+		}
+		// JWS ECDSA signatures are the fixed size concatenation of r and s.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	default:
+		return false
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
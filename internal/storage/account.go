@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// ChangePassword replaces the user's password after checking the current
+// one. Every other session of the user is revoked, the current one is kept.
+// Wrong passwords count towards the login limits like failed logins from the
+// address, see LoginThrottledError.
+func (s *Storage) ChangePassword(ctx context.Context, userID int64, currentSessionID, currentPassword, newPassword, ipAddress string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.ChangePassword tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	var login string
+	if err = tx.QueryRow(ctx, "SELECT login FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&login); err != nil {
+		return err
+	}
+
+	attempt, err := s.reserveLoginAttempt(ctx, login, ipAddress)
+	if err != nil {
+		return err
+	}
+	defer attempt.release(ctx)
+
+	if _, err = s.verifyPassword(ctx, tx, login, currentPassword); err != nil {
+		if errors.Is(err, ErrInvalidLoginPassword) {
+			attempt.fail(ctx)
+		}
+		return err
+	}
+
+	if err = s.setPassword(ctx, tx, userID, newPassword); err != nil {
+		return err
+	}
+
+	if _, err = s.deleteSessions(ctx, tx, "uid = $2 AND public_id <> $3", userID, currentSessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Password reset requests are limited per address, so the notifier can't be
+// flooded, and per user, so a user's inbox can't be.
+const (
+	passwordResetWindow     = 1 * time.Hour
+	passwordResetMaxPerIP   = 10
+	passwordResetMaxPerUser = 3
+)
+
+var ErrTooManyPasswordResets = errors.New("too many password reset requests")
+
+// CreatePasswordResetToken issues a single-use token that sets a new password
+// for the user with the login, see ResetPassword. Only its hash is stored.
+// Users without a local password sign in through the identity provider and
+// are reported as ErrUserNotFound, as are disabled users. Requests from an
+// address that made too many fail with a LoginThrottledError, requests for a
+// user that got too many tokens recently with ErrTooManyPasswordResets.
+func (s *Storage) CreatePasswordResetToken(ctx context.Context, login, ipAddress string) (string, time.Time, error) {
+	if err := s.recordPasswordResetRequest(ctx, ipAddress); err != nil {
+		return "", time.Time{}, err
+	}
+
+	var userID int64
+	var recentTokens int
+	err := s.db.QueryRow(ctx, "SELECT u.id, (SELECT count(*) FROM password_reset_tokens t WHERE t.uid = u.id AND t.created_at > $2) FROM users u WHERE u.login = $1 AND u.password_hash IS NOT NULL AND u.disabled_at IS NULL", login, time.Now().Add(-passwordResetWindow)).Scan(&userID, &recentTokens)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", time.Time{}, ErrUserNotFound
+		}
+		return "", time.Time{}, err
+	}
+	if recentTokens >= passwordResetMaxPerUser {
+		return "", time.Time{}, ErrTooManyPasswordResets
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(s.passwordResetTTL)
+
+	_, err = s.db.Exec(ctx, "INSERT INTO password_reset_tokens (token_hash, uid, expires_at) VALUES ($1, $2, $3)", hashToken(token), userID, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// recordPasswordResetRequest counts a password reset request from the
+// address, or fails with a LoginThrottledError if it made too many. Requests
+// from the same address are counted one after the other.
+func (s *Storage) recordPasswordResetRequest(ctx context.Context, ipAddress string) (err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.recordPasswordResetRequest tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "password_reset:"+ipAddress); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var requests int
+	var oldest *time.Time
+	err = tx.QueryRow(ctx, "SELECT count(*), min(requested_at) FROM password_reset_requests WHERE ip_address = $1 AND requested_at > $2", ipAddress, now.Add(-passwordResetWindow)).Scan(&requests, &oldest)
+	if err != nil {
+		return err
+	}
+	if requests >= passwordResetMaxPerIP && oldest != nil {
+		err = &LoginThrottledError{RetryAfter: oldest.Add(passwordResetWindow).Sub(now)}
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, "INSERT INTO password_reset_requests (ip_address, requested_at) VALUES ($1, $2)", ipAddress, now); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPasswordResetLogin returns the login of the user a password reset token
+// is for, for checking the new password against it. Unknown, used and expired
+// tokens fail with ErrInvalidToken.
+func (s *Storage) GetPasswordResetLogin(ctx context.Context, token string) (string, error) {
+	var login string
+	err := s.db.QueryRow(ctx, "SELECT u.login FROM password_reset_tokens t JOIN users u ON u.id = t.uid WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > now()", hashToken(token)).Scan(&login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidToken
+		}
+		return "", err
+	}
+
+	return login, nil
+}
+
+// ResetPassword sets a new password with a password reset token. All
+// sessions and outstanding reset tokens of the user are revoked and the
+// account's failed logins are forgotten. Unknown, used and expired tokens
+// fail with ErrInvalidToken.
+func (s *Storage) ResetPassword(ctx context.Context, token, newPassword string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.ResetPassword tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	var userID int64
+	var login string
+	err = tx.QueryRow(ctx, "UPDATE password_reset_tokens t SET used_at = now() FROM users u WHERE u.id = t.uid AND t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > now() RETURNING t.uid, u.login", hashToken(token)).Scan(&userID, &login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = ErrInvalidToken
+		}
+		return err
+	}
+
+	if err = s.setPassword(ctx, tx, userID, newPassword); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM password_reset_tokens WHERE uid = $1 AND used_at IS NULL", userID); err != nil {
+		return err
+	}
+
+	if _, err = s.deleteSessions(ctx, tx, "uid = $2", userID); err != nil {
+		return err
+	}
+
+	if err = s.clearLoginFailures(ctx, tx, login); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteAccount removes the user together with their sessions, API keys,
+// grants, share links and assets. The password is checked again for users
+// that have one. Organizations the user is the only member of are deleted
+// with their assets; being the last owner of an organization with other
+// members fails with ErrLastOwner. Wrong passwords count towards the login
+// limits like failed logins from the address.
+func (s *Storage) DeleteAccount(ctx context.Context, userID int64, password, ipAddress string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.DeleteAccount tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	var login string
+	var hasPassword bool
+	err = tx.QueryRow(ctx, "SELECT login, password_hash IS NOT NULL FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&login, &hasPassword)
+	if err != nil {
+		return err
+	}
+
+	if hasPassword {
+		var attempt *loginAttempt
+		attempt, err = s.reserveLoginAttempt(ctx, login, ipAddress)
+		if err != nil {
+			return err
+		}
+		defer attempt.release(ctx)
+
+		if _, err = s.verifyPassword(ctx, tx, login, password); err != nil {
+			if errors.Is(err, ErrInvalidLoginPassword) {
+				attempt.fail(ctx)
+			}
+			return err
+		}
+	}
+
+	namespaceIDs, err := s.accountNamespaces(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = s.deleteNamespaceAssets(ctx, tx, namespaceIDs); err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue("DELETE FROM organizations WHERE id = ANY($1)", namespaceIDs)
+	batch.Queue("DELETE FROM organization_members WHERE uid = $1", userID)
+	batch.Queue("DELETE FROM asset_grants WHERE owner_uid = ANY($1) OR grantee_uid = $2", namespaceIDs, userID)
+	batch.Queue("DELETE FROM share_links WHERE uid = ANY($1)", namespaceIDs)
+	batch.Queue("DELETE FROM api_keys WHERE uid = $1", userID)
+	batch.Queue("DELETE FROM recovery_codes WHERE uid = $1", userID)
+	batch.Queue("DELETE FROM two_factor_challenges WHERE uid = $1", userID)
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+
+	if _, err = s.deleteSessions(ctx, tx, "uid = $2", userID); err != nil {
+		return err
+	}
+
+	if err = s.clearLoginFailures(ctx, tx, login); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM users WHERE id = $1", userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	s.deleteNamespaceUploads(ctx, namespaceIDs)
+
+	return nil
+}
+
+// accountNamespaces returns the namespaces deleted with the user: their own
+// and those of the organizations nobody else belongs to.
+func (s *Storage) accountNamespaces(ctx context.Context, tx pgx.Tx, userID int64) ([]int64, error) {
+	rows, err := tx.Query(ctx, "SELECT m.org_id, m.role, (SELECT COUNT(*) FROM organization_members o WHERE o.org_id = m.org_id AND o.uid <> m.uid), (SELECT COUNT(*) FROM organization_members o WHERE o.org_id = m.org_id AND o.uid <> m.uid AND o.role = $2) FROM organization_members m WHERE m.uid = $1", userID, types.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	namespaceIDs := []int64{userID}
+	for rows.Next() {
+		var orgID int64
+		var role string
+		var otherMembers, otherOwners int
+		if err := rows.Scan(&orgID, &role, &otherMembers, &otherOwners); err != nil {
+			return nil, err
+		}
+		if otherMembers == 0 {
+			namespaceIDs = append(namespaceIDs, orgID)
+		} else if role == types.RoleOwner && otherOwners == 0 {
+			return nil, ErrLastOwner
+		}
+	}
+
+	return namespaceIDs, rows.Err()
+}
+
+// deleteNamespaceAssets deletes every asset version in the namespaces and
+// releases their blobs.
+func (s *Storage) deleteNamespaceAssets(ctx context.Context, tx pgx.Tx, namespaceIDs []int64) error {
+	rows, err := tx.Query(ctx, "DELETE FROM assets WHERE uid = ANY($1) RETURNING blob_key", namespaceIDs)
+	if err != nil {
+		return err
+	}
+
+	var blobKeys []string
+	for rows.Next() {
+		var blobKey string
+		if err := rows.Scan(&blobKey); err != nil {
+			rows.Close()
+			return err
+		}
+		blobKeys = append(blobKeys, blobKey)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return s.releaseBlobs(ctx, tx, blobKeys)
+}
+
+// deleteNamespaceUploads removes the unfinished uploads into the namespaces.
+// Leftovers would expire anyway, so failures are only logged.
+func (s *Storage) deleteNamespaceUploads(ctx context.Context, namespaceIDs []int64) {
+	ctx = context.WithoutCancel(ctx)
+
+	_, blobKeys, err := s.deleteUploads(ctx, "uid = ANY($1)", namespaceIDs)
+	if err != nil {
+		log.Printf("storage.deleteNamespaceUploads error: %v", err)
+	}
+	_, partKeys, err := s.deleteMultipartUploads(ctx, "uid = ANY($1)", namespaceIDs)
+	if err != nil {
+		log.Printf("storage.deleteNamespaceUploads error: %v", err)
+	}
+
+	for _, blobKey := range append(blobKeys, partKeys...) {
+		s.deleteBlob(ctx, blobKey)
+	}
+}
+
+// setPassword stores a hash of the new password.
+func (s *Storage) setPassword(ctx context.Context, tx pgx.Tx, userID int64, password string) error {
+	passwordHash, err := s.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET password_hash = $2, password_trimmed = FALSE WHERE id = $1", userID, passwordHash)
+	return err
+}
@@ -0,0 +1,447 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+var ErrAccountDisabled = errors.New("account disabled")
+var ErrOwnAccount = errors.New("admins can't disable or demote themselves")
+
+// userAccountQuery selects the columns scanned by scanUserAccount. Usage
+// counts every version stored in the user's own namespace.
+const userAccountQuery = "SELECT u.id, u.login, u.is_admin, u.disabled_at, u.totp_enabled, u.password_hash IS NULL, u.created_at, a.assets, a.versions, a.bytes, (SELECT COUNT(*) FROM sessions s WHERE s.uid = u.id AND GREATEST(s.expires_at, s.refresh_expires_at) > now()) FROM users u LEFT JOIN LATERAL (SELECT COUNT(DISTINCT name) AS assets, COUNT(*) AS versions, COALESCE(SUM(size), 0)::bigint AS bytes FROM assets WHERE uid = u.id) a ON TRUE"
+
+// IsAdmin reports whether the user has the admin role. Disabled admins have
+// none.
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	var admin bool
+	err := s.db.QueryRow(ctx, "SELECT is_admin AND disabled_at IS NULL FROM users WHERE id = $1", userID).Scan(&admin)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return admin, nil
+}
+
+// BootstrapAdminRole gives the users with the logins the admin role, so the
+// first administrator can be set up from the configuration. It does nothing
+// once there is an admin, and never gives the role back to a user it was
+// revoked from. Grants are recorded in the audit log without an admin.
+func (s *Storage) BootstrapAdminRole(ctx context.Context, logins []string) (err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.BootstrapAdminRole tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	// Instances starting together bootstrap one after the other.
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('admin_bootstrap'))"); err != nil {
+		return err
+	}
+
+	var adminExists bool
+	if err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE is_admin)").Scan(&adminExists); err != nil {
+		return err
+	}
+	if adminExists {
+		return tx.Commit(ctx)
+	}
+
+	rows, err := tx.Query(ctx, "UPDATE users u SET is_admin = TRUE WHERE u.login = ANY($1) AND u.disabled_at IS NULL AND NOT EXISTS (SELECT 1 FROM admin_audit_log a WHERE a.action = $2 AND a.target = u.login) RETURNING u.login", logins, types.AdminActionRevokeAdmin)
+	if err != nil {
+		return err
+	}
+	var granted []string
+	for rows.Next() {
+		var login string
+		if err = rows.Scan(&login); err != nil {
+			rows.Close()
+			return err
+		}
+		granted = append(granted, login)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, login := range granted {
+		_, err = tx.Exec(ctx, "INSERT INTO admin_audit_log (admin_uid, admin_login, action, target) VALUES (NULL, '', $1, $2)", types.AdminActionBootstrapAdmin, login)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	for _, login := range granted {
+		log.Printf("Granted the admin role to %q", login)
+	}
+	return nil
+}
+
+// ListUsers returns the users whose login contains search, ignoring case, or
+// all users if it is empty, oldest first.
+func (s *Storage) ListUsers(ctx context.Context, adminID int64, search string, limit, offset int) ([]types.UserAccount, error) {
+	rows, err := s.db.Query(ctx, userAccountQuery+" WHERE $1 = '' OR strpos(lower(u.login), lower($1)) > 0 ORDER BY u.id LIMIT $2 OFFSET $3", search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []types.UserAccount
+	for rows.Next() {
+		user, err := scanUserAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{}
+	if search != "" {
+		details["search"] = search
+	}
+	if err := s.recordAdminAction(ctx, s.db, adminID, types.AdminActionListUsers, "", details); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetUserAccount returns the user with the login.
+func (s *Storage) GetUserAccount(ctx context.Context, adminID int64, login string) (types.UserAccount, error) {
+	user, err := scanUserAccount(s.db.QueryRow(ctx, userAccountQuery+" WHERE u.login = $1", login))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.UserAccount{}, ErrUserNotFound
+		}
+		return types.UserAccount{}, err
+	}
+
+	if err := s.recordAdminAction(ctx, s.db, adminID, types.AdminActionViewUser, login, nil); err != nil {
+		return types.UserAccount{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateUser grants or revokes the admin role of the user with the login and
+// disables or enables the user, whichever of admin and disabled is set. Both
+// changes and their audit entries are applied in one transaction.
+//
+// Disabling revokes the user's sessions and pending logins; API keys stay but
+// are rejected until the user is enabled again. Enabling also forgets the
+// account's failed logins.
+func (s *Storage) UpdateUser(ctx context.Context, adminID int64, login string, admin, disabled *bool) error {
+	return s.lockUser(ctx, "storage.UpdateUser", login, func(tx pgx.Tx, userID int64) error {
+		if admin != nil {
+			action, err := s.setUserAdmin(ctx, tx, adminID, userID, *admin)
+			if err != nil {
+				return err
+			}
+			if err := s.recordAdminAction(ctx, tx, adminID, action, login, nil); err != nil {
+				return err
+			}
+		}
+
+		if disabled != nil {
+			action, details, err := s.setUserDisabled(ctx, tx, adminID, userID, login, *disabled)
+			if err != nil {
+				return err
+			}
+			if err := s.recordAdminAction(ctx, tx, adminID, action, login, details); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// setUserAdmin grants or revokes the admin role and returns the audit action.
+func (s *Storage) setUserAdmin(ctx context.Context, tx pgx.Tx, adminID, userID int64, admin bool) (string, error) {
+	if !admin && userID == adminID {
+		return "", ErrOwnAccount
+	}
+	if _, err := tx.Exec(ctx, "UPDATE users SET is_admin = $2 WHERE id = $1", userID, admin); err != nil {
+		return "", err
+	}
+
+	if !admin {
+		return types.AdminActionRevokeAdmin, nil
+	}
+	return types.AdminActionGrantAdmin, nil
+}
+
+// setUserDisabled disables or enables the user and returns the audit action
+// and its details.
+func (s *Storage) setUserDisabled(ctx context.Context, tx pgx.Tx, adminID, userID int64, login string, disabled bool) (string, map[string]interface{}, error) {
+	if !disabled {
+		if _, err := tx.Exec(ctx, "UPDATE users SET disabled_at = NULL WHERE id = $1", userID); err != nil {
+			return "", nil, err
+		}
+		if err := s.clearLoginFailures(ctx, tx, login); err != nil {
+			return "", nil, err
+		}
+		return types.AdminActionEnableUser, nil, nil
+	}
+
+	if userID == adminID {
+		return "", nil, ErrOwnAccount
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue("UPDATE users SET disabled_at = COALESCE(disabled_at, now()) WHERE id = $1", userID)
+	batch.Queue("DELETE FROM two_factor_challenges WHERE uid = $1", userID)
+	batch.Queue("DELETE FROM password_reset_tokens WHERE uid = $1 AND used_at IS NULL", userID)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return "", nil, err
+	}
+
+	revoked, err := s.deleteSessions(ctx, tx, "uid = $2", userID)
+	if err != nil {
+		return "", nil, err
+	}
+	return types.AdminActionDisableUser, map[string]interface{}{"sessions_revoked": revoked}, nil
+}
+
+// RevokeUserSessions logs the user with the login out everywhere and returns
+// the number of revoked sessions.
+func (s *Storage) RevokeUserSessions(ctx context.Context, adminID int64, login string) (int64, error) {
+	var revoked int64
+	err := s.changeUser(ctx, "storage.RevokeUserSessions", adminID, login, types.AdminActionRevokeSessions, func(tx pgx.Tx, userID int64) (map[string]interface{}, error) {
+		var err error
+		revoked, err = s.deleteSessions(ctx, tx, "uid = $2", userID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"sessions_revoked": revoked}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return revoked, nil
+}
+
+// ListUserAssets returns the latest versions of the assets in the namespace
+// of the user with the login.
+func (s *Storage) ListUserAssets(ctx context.Context, adminID int64, login string, limit, offset int) ([]types.Asset, error) {
+	userID, err := s.userIDByLogin(ctx, s.db, login)
+	if err != nil {
+		return nil, err
+	}
+
+	assets, err := s.listLatestAssets(ctx, "uid = $1", userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.recordAdminAction(ctx, s.db, adminID, types.AdminActionListAssets, login, nil); err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+// DeleteUserAsset removes a version of an asset of the user with the login,
+// or all of its versions if version is 0.
+func (s *Storage) DeleteUserAsset(ctx context.Context, adminID int64, login, assetName string, version int) error {
+	return s.changeUser(ctx, "storage.DeleteUserAsset", adminID, login, types.AdminActionDeleteAsset, func(tx pgx.Tx, userID int64) (map[string]interface{}, error) {
+		current, err := s.lockAsset(ctx, tx, userID, assetName, version)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, ErrAssetNotFound
+		}
+
+		if err := s.deleteAssetRows(ctx, tx, userID, assetName, version); err != nil {
+			return nil, err
+		}
+		if err := s.revokeAssetAccess(ctx, tx, userID, assetName); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"asset": assetName, "version": version}, nil
+	})
+}
+
+// ClearLoginFailures lifts the backoff or lockout of the account with the
+// login. The login doesn't have to exist, failed logins are counted for
+// unknown logins too.
+func (s *Storage) ClearLoginFailures(ctx context.Context, adminID int64, login string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.ClearLoginFailures tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	if err = s.clearLoginFailures(ctx, tx, login); err != nil {
+		return err
+	}
+
+	if err = s.recordAdminAction(ctx, tx, adminID, types.AdminActionClearLoginFailures, login, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListLoginLockouts returns the recorded login lockouts, newest first.
+func (s *Storage) ListLoginLockouts(ctx context.Context, adminID int64, limit, offset int) ([]types.LoginLockout, error) {
+	rows, err := s.db.Query(ctx, "SELECT id, kind, subject, failures, locked_until, created_at FROM login_lockouts ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []types.LoginLockout
+	for rows.Next() {
+		var lockout types.LoginLockout
+		if err := rows.Scan(&lockout.ID, &lockout.Kind, &lockout.Subject, &lockout.Failures, &lockout.LockedUntil, &lockout.CreatedAt); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, lockout)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.recordAdminAction(ctx, s.db, adminID, types.AdminActionListLoginLockouts, "", nil); err != nil {
+		return nil, err
+	}
+
+	return lockouts, nil
+}
+
+// ListAuditLog returns the actions taken through the admin API, newest
+// first. Reading the audit log is the one action that isn't recorded.
+func (s *Storage) ListAuditLog(ctx context.Context, limit, offset int) ([]types.AuditLogEntry, error) {
+	rows, err := s.db.Query(ctx, "SELECT id, admin_login, action, target, details, created_at FROM admin_audit_log ORDER BY id DESC LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []types.AuditLogEntry
+	for rows.Next() {
+		var entry types.AuditLogEntry
+		if err := rows.Scan(&entry.ID, &entry.AdminLogin, &entry.Action, &entry.Target, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// changeUser applies an administrative change to the user with the login and
+// records it in the audit log with the details change returns, all in one
+// transaction.
+func (s *Storage) changeUser(ctx context.Context, operation string, adminID int64, login, action string, change func(tx pgx.Tx, userID int64) (map[string]interface{}, error)) error {
+	return s.lockUser(ctx, operation, login, func(tx pgx.Tx, userID int64) error {
+		details, err := change(tx, userID)
+		if err != nil {
+			return err
+		}
+		return s.recordAdminAction(ctx, tx, adminID, action, login, details)
+	})
+}
+
+// lockUser runs change in a transaction holding the row of the user with the
+// login, and commits it unless change fails.
+func (s *Storage) lockUser(ctx context.Context, operation, login string, change func(tx pgx.Tx, userID int64) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("%s tx.Rollback error: %v", operation, errRollback)
+			}
+		}
+	}()
+
+	var userID int64
+	err = tx.QueryRow(ctx, "SELECT id FROM users WHERE login = $1 FOR UPDATE", login).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = ErrUserNotFound
+		}
+		return err
+	}
+
+	if err = change(tx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// recordAdminAction adds an entry to the audit log.
+func (s *Storage) recordAdminAction(ctx context.Context, q execer, adminID int64, action, target string, details map[string]interface{}) error {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+
+	tag, err := q.Exec(ctx, "INSERT INTO admin_audit_log (admin_uid, admin_login, action, target, details) SELECT id, login, $2, $3, $4 FROM users WHERE id = $1", adminID, action, target, details)
+	if err != nil {
+		return err
+	}
+	// Nothing may happen without an audit entry, even if the admin was
+	// deleted meanwhile.
+	if tag.RowsAffected() != 1 {
+		return fmt.Errorf("audit log entry for admin %d not recorded", adminID)
+	}
+
+	return nil
+}
+
+// userIDByLogin returns the ID of the user with the login.
+func (s *Storage) userIDByLogin(ctx context.Context, q queryRower, login string) (int64, error) {
+	var userID int64
+	err := q.QueryRow(ctx, "SELECT id FROM users WHERE login = $1", login).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func scanUserAccount(row pgx.Row) (types.UserAccount, error) {
+	var user types.UserAccount
+	err := row.Scan(&user.ID, &user.Login, &user.Admin, &user.DisabledAt, &user.TwoFactorEnabled, &user.External, &user.CreatedAt, &user.Assets, &user.AssetVersions, &user.StorageBytes, &user.ActiveSessions)
+	return user, err
+}
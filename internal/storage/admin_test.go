@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgconn"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// auditLog answers the INSERT of recordAdminAction with a fixed number of rows.
+type auditLog struct {
+	rows int
+}
+
+func (l auditLog) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if l.rows == 0 {
+		return pgconn.CommandTag("INSERT 0 0"), nil
+	}
+	return pgconn.CommandTag("INSERT 0 1"), nil
+}
+
+func TestRecordAdminActionRequiresEntry(t *testing.T) {
+	s := &Storage{}
+
+	if err := s.recordAdminAction(context.Background(), auditLog{rows: 1}, 1, types.AdminActionViewUser, "alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The admin was deleted, so no entry is inserted.
+	if err := s.recordAdminAction(context.Background(), auditLog{rows: 0}, 1, types.AdminActionViewUser, "alice", nil); err == nil {
+		t.Fatal("action without an audit entry allowed")
+	}
+}
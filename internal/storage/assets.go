@@ -2,48 +2,174 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
 	"io"
+	"log"
+
+	"github.com/jackc/pgx/v4"
 
 	"github.com/ArturV19/file-storage/internal/types"
 )
 
 var ErrAssetAlreadyExists = errors.New("asset already exists")
 var ErrAssetNotFound = errors.New("asset not found")
+var ErrAssetTooLarge = errors.New("asset too large")
+var ErrVersioningDisabled = errors.New("versioning disabled")
+var ErrDigestMismatch = errors.New("content digest mismatch")
 
-func (s *Storage) UploadAsset(ctx context.Context, uploadAssetData types.UploadAssetData) error {
-	data, err := io.ReadAll(uploadAssetData.Body)
+// UploadAsset stores a new asset. With versioning enabled an upload under an
+// existing name becomes its next version. Otherwise it fails with
+// ErrAssetAlreadyExists unless Overwrite is set, in which case the previous
+// content is replaced. The SHA-256 of the content is kept as the ETag, and
+// content that is already stored is referenced rather than stored again.
+// When the client announces the digest of content that is already stored,
+// the body is only hashed to verify the digest and is not written at all.
+func (s *Storage) UploadAsset(ctx context.Context, uploadAssetData types.UploadAssetData) (types.Asset, error) {
+	// Fail before the content is written if the upload is bound to fail. The
+	// check is repeated under the asset lock below.
+	current, err := s.assetVersion(ctx, s.db, uploadAssetData.UserID, uploadAssetData.AssetName, 0)
 	if err != nil {
-		return err
+		return types.Asset{}, err
+	}
+	if err := s.uploadConflict(current, uploadAssetData); err != nil {
+		return types.Asset{}, err
+	}
+
+	// Content that is stored already is pinned before the body is read, so
+	// it can't be collected before the new asset references it.
+	pinnedBlobKey, err := s.pinStoredContent(ctx, uploadAssetData.SHA256)
+	if err != nil {
+		return types.Asset{}, err
+	}
+	defer func() {
+		// Cleared once the asset holds the reference.
+		s.unpinBlob(ctx, pinnedBlobKey)
+	}()
+
+	// blobKey stays empty when the content is already stored.
+	var blobKey string
+	var size int64
+	hash := sha256.New()
+	if pinnedBlobKey != "" {
+		size, err = io.Copy(hash, uploadAssetData.Body)
+	} else {
+		blobKey, size, err = s.blobs.Put(ctx, io.TeeReader(uploadAssetData.Body, hash))
+	}
+	if err != nil {
+		return types.Asset{}, err
 	}
 
-	_, err = s.db.Exec(ctx, "INSERT INTO assets (name, original_name, uid, data, content_type) VALUES ($1, $2, $3, $4, $5)", uploadAssetData.AssetName, uploadAssetData.OriginalName, uploadAssetData.UserID, data, uploadAssetData.ContentType)
+	asset := types.Asset{
+		Name:         uploadAssetData.AssetName,
+		OriginalName: uploadAssetData.OriginalName,
+		ContentType:  uploadAssetData.ContentType,
+		Size:         size,
+		ETag:         hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	if uploadAssetData.SHA256 != "" && uploadAssetData.SHA256 != asset.ETag {
+		s.deleteBlob(ctx, blobKey)
+		return types.Asset{}, ErrDigestMismatch
+	}
+
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.UniqueViolation {
-			return ErrAssetAlreadyExists
+		s.deleteBlob(ctx, blobKey)
+		return types.Asset{}, err
+	}
+	defer func() {
+		if err != nil {
+			s.deleteBlob(ctx, blobKey)
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.UploadAsset tx.Rollback error: %v", errRollback)
+			}
 		}
-		return err
+	}()
+
+	current, err = s.lockAsset(ctx, tx, uploadAssetData.UserID, uploadAssetData.AssetName, 0)
+	if err != nil {
+		return types.Asset{}, err
 	}
 
-	return nil
+	if err = s.uploadConflict(current, uploadAssetData); err != nil {
+		return types.Asset{}, err
+	}
+
+	asset.Version = 1
+	if current != nil {
+		asset.Version = current.Version + 1
+
+		if !s.versioning {
+			if err = s.deleteAssetRows(ctx, tx, uploadAssetData.UserID, uploadAssetData.AssetName, 0); err != nil {
+				return types.Asset{}, err
+			}
+		}
+	}
+
+	storedBlobKey := pinnedBlobKey
+	if blobKey != "" {
+		storedBlobKey, err = s.registerBlob(ctx, tx, blobKey, asset.ETag, asset.Size)
+		if err != nil {
+			return types.Asset{}, err
+		}
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO assets (name, version, original_name, uid, blob_key, size, content_type, sha256) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at", asset.Name, asset.Version, asset.OriginalName, uploadAssetData.UserID, storedBlobKey, asset.Size, asset.ContentType, asset.ETag).Scan(&asset.CreatedAt)
+	if err != nil {
+		return types.Asset{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.Asset{}, err
+	}
+	pinnedBlobKey = ""
+
+	if storedBlobKey != blobKey {
+		// The content was already stored, the new copy is not needed.
+		s.deleteBlob(ctx, blobKey)
+	}
+
+	return asset, nil
 }
 
-func (s *Storage) GetAsset(ctx context.Context, userID int64, assetName string) ([]byte, string, string, error) {
-	var data []byte
-	var originalName, contentType string
-	err := s.db.QueryRow(ctx, "SELECT data, original_name, content_type FROM assets WHERE name = $1 AND uid = $2", assetName, userID).Scan(&data, &originalName, &contentType)
+// GetAsset opens the asset for streaming. Version 0 selects the latest
+// version. The caller must close the body.
+func (s *Storage) GetAsset(ctx context.Context, userID int64, assetName string, version int) (*types.AssetContent, error) {
+	var blobKey string
+	var originalName *string
+	content := &types.AssetContent{}
+	err := s.db.QueryRow(ctx, "SELECT blob_key, version, original_name, content_type, size, COALESCE(sha256, ''), created_at FROM assets WHERE name = $1 AND uid = $2 AND ($3 = 0 OR version = $3) ORDER BY version DESC LIMIT 1", assetName, userID, version).Scan(&blobKey, &content.Version, &originalName, &content.ContentType, &content.Size, &content.ETag, &content.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAssetNotFound
+		}
+		return nil, err
+	}
+	if originalName != nil {
+		content.OriginalName = *originalName
+	}
 
+	content.Body, err = s.blobs.Open(ctx, blobKey)
 	if err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 
-	return data, originalName, contentType, nil
+	return content, nil
 }
 
+// GetUserAssetsList returns the latest versions of the user's own assets and
+// of the assets other users have shared with them.
 func (s *Storage) GetUserAssetsList(ctx context.Context, userID int64, limit, offset int) ([]types.Asset, error) {
-	rows, err := s.db.Query(ctx, "SELECT name, original_name, content_type, created_at FROM assets WHERE uid = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3", userID, limit, offset)
+	return s.listLatestAssets(ctx, "uid = $1 OR EXISTS (SELECT 1 FROM asset_grants g WHERE g.grantee_uid = $1 AND "+grantCoversAsset("assets.uid", "assets.name")+")", userID, limit, offset)
+}
+
+// listLatestAssets returns the latest version of every asset matching the
+// condition, newest first. The condition refers to the namespace ID as $1;
+// assets of other users carry the owner's login.
+func (s *Storage) listLatestAssets(ctx context.Context, condition string, userID int64, limit, offset int) ([]types.Asset, error) {
+	rows, err := s.db.Query(ctx, "SELECT latest.name, latest.version, latest.original_name, latest.content_type, latest.size, COALESCE(latest.sha256, ''), latest.created_at, CASE WHEN latest.uid = $1 THEN '' ELSE COALESCE(u.login, '') END FROM (SELECT DISTINCT ON (uid, name) * FROM assets WHERE "+condition+" ORDER BY uid, name, version DESC) latest LEFT JOIN users u ON u.id = latest.uid ORDER BY latest.created_at DESC LIMIT $2 OFFSET $3", userID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +179,7 @@ func (s *Storage) GetUserAssetsList(ctx context.Context, userID int64, limit, of
 
 	for rows.Next() {
 		var file types.Asset
-		err := rows.Scan(&file.Name, &file.OriginalName, &file.ContentType, &file.CreatedAt)
+		err := rows.Scan(&file.Name, &file.Version, &file.OriginalName, &file.ContentType, &file.Size, &file.ETag, &file.CreatedAt, &file.Owner)
 		if err != nil {
 			return nil, err
 		}
@@ -63,16 +189,257 @@ func (s *Storage) GetUserAssetsList(ctx context.Context, userID int64, limit, of
 	return files, nil
 }
 
-func (s *Storage) DeleteAsset(ctx context.Context, userID int64, assetName string) error {
-	result, err := s.db.Exec(ctx, "DELETE FROM assets WHERE name = $1 AND uid = $2", assetName, userID)
+func (s *Storage) ListAssetVersions(ctx context.Context, userID int64, assetName string) ([]types.AssetVersion, error) {
+	rows, err := s.db.Query(ctx, "SELECT version, original_name, content_type, size, COALESCE(sha256, ''), created_at FROM assets WHERE name = $1 AND uid = $2 ORDER BY version DESC", assetName, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []types.AssetVersion
+	for rows.Next() {
+		var version types.AssetVersion
+		var originalName *string
+		err := rows.Scan(&version.Version, &originalName, &version.ContentType, &version.Size, &version.ETag, &version.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if originalName != nil {
+			version.OriginalName = *originalName
+		}
+		version.IsLatest = len(versions) == 0
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrAssetNotFound
+	}
+
+	return versions, nil
+}
+
+// RestoreAssetVersion adds a new latest version with the content of an older
+// one. The content is shared, not copied.
+func (s *Storage) RestoreAssetVersion(ctx context.Context, userID int64, assetName string, version int) (types.Asset, error) {
+	if !s.versioning {
+		return types.Asset{}, ErrVersioningDisabled
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return types.Asset{}, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.RestoreAssetVersion tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	latest, err := s.lockAsset(ctx, tx, userID, assetName, 0)
 	if err != nil {
+		return types.Asset{}, err
+	}
+	if latest == nil {
+		err = ErrAssetNotFound
+		return types.Asset{}, err
+	}
+
+	var blobKey string
+	var digest *string
+	var originalName *string
+	asset := types.Asset{Name: assetName, Version: latest.Version + 1}
+	err = tx.QueryRow(ctx, "SELECT blob_key, sha256, original_name, content_type, size FROM assets WHERE name = $1 AND uid = $2 AND version = $3", assetName, userID, version).Scan(&blobKey, &digest, &originalName, &asset.ContentType, &asset.Size)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = ErrAssetNotFound
+		}
+		return types.Asset{}, err
+	}
+	if digest != nil {
+		asset.ETag = *digest
+	}
+	if originalName != nil {
+		asset.OriginalName = *originalName
+	}
+
+	if err = s.retainBlob(ctx, tx, blobKey); err != nil {
+		return types.Asset{}, err
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO assets (name, version, original_name, uid, blob_key, size, content_type, sha256) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at", asset.Name, asset.Version, originalName, userID, blobKey, asset.Size, asset.ContentType, digest).Scan(&asset.CreatedAt)
+	if err != nil {
+		return types.Asset{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.Asset{}, err
+	}
+
+	return asset, nil
+}
+
+// DeleteAsset removes a single version of the asset, or all of its versions
+// if version is 0. The precondition, if any, is checked against the targeted
+// version. Blobs are removed by RemoveUnreferencedBlobs once nothing refers
+// to them. Share links and grants to the asset are revoked once its last
+// version is gone.
+func (s *Storage) DeleteAsset(ctx context.Context, userID int64, assetName string, version int, precondition types.AssetPrecondition) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.DeleteAsset tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	current, err := s.lockAsset(ctx, tx, userID, assetName, version)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		err = ErrAssetNotFound
+		return err
+	}
+
+	if precondition != nil {
+		if err = precondition(current); err != nil {
+			return err
+		}
+	}
+
+	if err = s.deleteAssetRows(ctx, tx, userID, assetName, version); err != nil {
+		return err
+	}
+
+	if err = s.revokeAssetAccess(ctx, tx, userID, assetName); err != nil {
 		return err
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return ErrAssetNotFound
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkAssetCanBeCreated fails with ErrAssetAlreadyExists if an upload under
+// the name would be rejected. It lets staged uploads fail early.
+func (s *Storage) checkAssetCanBeCreated(ctx context.Context, userID int64, assetName string) error {
+	if s.versioning {
+		return nil
+	}
+
+	var exists bool
+	err := s.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM assets WHERE name = $1 AND uid = $2)", assetName, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAssetAlreadyExists
 	}
 
 	return nil
 }
+
+// uploadConflict reports why an upload can't be stored over current, the
+// latest version of the asset or nil.
+func (s *Storage) uploadConflict(current *types.Asset, uploadAssetData types.UploadAssetData) error {
+	if uploadAssetData.Precondition != nil {
+		if err := uploadAssetData.Precondition(current); err != nil {
+			return err
+		}
+	}
+
+	if current != nil && !s.versioning && !uploadAssetData.Overwrite {
+		return ErrAssetAlreadyExists
+	}
+
+	return nil
+}
+
+// lockAsset locks the asset name for the rest of the transaction and returns
+// the given version, or the latest one if version is 0. It returns nil if
+// there is no such version.
+func (s *Storage) lockAsset(ctx context.Context, tx pgx.Tx, userID int64, assetName string, version int) (*types.Asset, error) {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtextextended($1, $2))", assetName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.assetVersion(ctx, tx, userID, assetName, version)
+}
+
+// assetVersion returns the given version of the asset, or the latest one if
+// version is 0. It returns nil if there is no such version.
+func (s *Storage) assetVersion(ctx context.Context, q queryRower, userID int64, assetName string, version int) (*types.Asset, error) {
+	var originalName *string
+	asset := &types.Asset{Name: assetName}
+	err := q.QueryRow(ctx, "SELECT version, original_name, content_type, size, COALESCE(sha256, ''), created_at FROM assets WHERE name = $1 AND uid = $2 AND ($3 = 0 OR version = $3) ORDER BY version DESC LIMIT 1", assetName, userID, version).Scan(&asset.Version, &originalName, &asset.ContentType, &asset.Size, &asset.ETag, &asset.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if originalName != nil {
+		asset.OriginalName = *originalName
+	}
+
+	return asset, nil
+}
+
+// revokeAssetAccess removes the share links and the grants to an asset whose
+// last version has been deleted, so that a new asset created under the same
+// name is not exposed through them. Prefix grants are kept, they don't refer
+// to a single asset.
+func (s *Storage) revokeAssetAccess(ctx context.Context, tx pgx.Tx, userID int64, assetName string) error {
+	if err := s.revokeShareLinks(ctx, tx, userID, assetName); err != nil {
+		return err
+	}
+	return s.revokeAssetGrants(ctx, tx, userID, assetName)
+}
+
+// deleteAssetRows deletes the given version of the asset, or all versions if
+// version is 0, and releases their blobs.
+func (s *Storage) deleteAssetRows(ctx context.Context, tx pgx.Tx, userID int64, assetName string, version int) error {
+	rows, err := tx.Query(ctx, "DELETE FROM assets WHERE name = $1 AND uid = $2 AND ($3 = 0 OR version = $3) RETURNING blob_key", assetName, userID, version)
+	if err != nil {
+		return err
+	}
+
+	var blobKeys []string
+	for rows.Next() {
+		var blobKey string
+		if err := rows.Scan(&blobKey); err != nil {
+			rows.Close()
+			return err
+		}
+		blobKeys = append(blobKeys, blobKey)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return s.releaseBlobs(ctx, tx, blobKeys)
+}
+
+// deleteBlob removes a blob that is no longer referenced. Failures only leave
+// an orphaned blob behind, so they are logged rather than returned.
+func (s *Storage) deleteBlob(ctx context.Context, blobKey string) {
+	if blobKey == "" {
+		return
+	}
+	if err := s.blobs.Delete(context.WithoutCancel(ctx), blobKey); err != nil {
+		log.Printf("storage.deleteBlob error: %v", err)
+	}
+}
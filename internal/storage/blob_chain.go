@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/ArturV19/file-storage/internal/blobstore"
+)
+
+// blobChain reads a sequence of blobs as one stream. Only one blob is open at
+// a time, so chaining many parts does not hold many backend resources.
+type blobChain struct {
+	ctx     context.Context
+	blobs   blobstore.Store
+	keys    []string
+	current io.ReadCloser
+}
+
+func newBlobChain(ctx context.Context, blobs blobstore.Store, keys []string) *blobChain {
+	return &blobChain{ctx: ctx, blobs: blobs, keys: keys}
+}
+
+func (c *blobChain) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+
+			blob, err := c.blobs.Open(c.ctx, c.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current = blob
+			c.keys = c.keys[1:]
+		}
+
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			if errClose := c.current.Close(); errClose != nil {
+				return n, errClose
+			}
+			c.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *blobChain) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	err := c.current.Close()
+	c.current = nil
+	return err
+}
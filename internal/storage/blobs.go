@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Asset content is stored once per SHA-256 digest. The blobs table counts
+// the asset versions referring to each blob; blobs that are no longer
+// referenced are removed by RemoveUnreferencedBlobs.
+
+// checkBlobBackend records the configured backend on the first start and
+// fails if blobs were written by a different one: their keys cannot be read
+// by the new backend and every existing asset would return 404.
+func checkBlobBackend(ctx context.Context, db *pgxpool.Pool, backend string) error {
+	_, err := db.Exec(ctx, "INSERT INTO blob_backend (backend) VALUES ($1) ON CONFLICT DO NOTHING", backend)
+	if err != nil {
+		return fmt.Errorf("failed to record blob store backend: %w", err)
+	}
+
+	var storedBackend string
+	err = db.QueryRow(ctx, "SELECT backend FROM blob_backend").Scan(&storedBackend)
+	if err != nil {
+		return fmt.Errorf("failed to read blob store backend: %w", err)
+	}
+
+	if storedBackend != backend {
+		return fmt.Errorf("blobs are stored in the %q backend but STORAGE_BACKEND is %q; existing blobs are not migrated", storedBackend, backend)
+	}
+
+	return nil
+}
+
+// pinStoredContent takes a reference to a stored blob with content with the
+// digest and returns its key, or an empty key if there is none. The
+// reference keeps the garbage collector from removing the content while the
+// upload is in progress, and is handed over to the new asset or dropped with
+// unpinBlob. An empty digest is never stored.
+func (s *Storage) pinStoredContent(ctx context.Context, sha256 string) (string, error) {
+	if sha256 == "" {
+		return "", nil
+	}
+
+	var blobKey string
+	err := s.db.QueryRow(ctx, "UPDATE blobs SET ref_count = ref_count + 1 WHERE sha256 = $1 AND ref_count > 0 RETURNING blob_key", sha256).Scan(&blobKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return blobKey, err
+}
+
+// unpinBlob drops the reference taken by pinStoredContent. It does nothing
+// for an empty key.
+func (s *Storage) unpinBlob(ctx context.Context, blobKey string) {
+	if blobKey == "" {
+		return
+	}
+
+	_, err := s.db.Exec(context.WithoutCancel(ctx), "UPDATE blobs SET ref_count = ref_count - 1 WHERE blob_key = $1", blobKey)
+	if err != nil {
+		log.Printf("storage.unpinBlob error: %v", err)
+	}
+}
+
+// registerBlob records a reference to content with the given digest and
+// returns the key of the blob that holds it. If the content is already
+// stored, the existing blob is referenced and its key is returned instead of
+// blobKey, which the caller should then delete.
+func (s *Storage) registerBlob(ctx context.Context, tx pgx.Tx, blobKey, sha256 string, size int64) (string, error) {
+	var storedBlobKey string
+	err := tx.QueryRow(ctx, "INSERT INTO blobs (blob_key, sha256, size, ref_count) VALUES ($1, $2, $3, 1) ON CONFLICT (sha256) DO UPDATE SET ref_count = blobs.ref_count + 1 RETURNING blob_key", blobKey, sha256, size).Scan(&storedBlobKey)
+	if err != nil {
+		return "", err
+	}
+
+	return storedBlobKey, nil
+}
+
+// retainBlob adds a reference to an already stored blob.
+func (s *Storage) retainBlob(ctx context.Context, tx pgx.Tx, blobKey string) error {
+	_, err := tx.Exec(ctx, "UPDATE blobs SET ref_count = ref_count + 1 WHERE blob_key = $1", blobKey)
+	return err
+}
+
+// releaseBlobs drops one reference per occurrence of a key in blobKeys.
+func (s *Storage) releaseBlobs(ctx context.Context, tx pgx.Tx, blobKeys []string) error {
+	if len(blobKeys) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, "UPDATE blobs b SET ref_count = b.ref_count - released.count FROM (SELECT blob_key, COUNT(*) AS count FROM unnest($1::text[]) AS blob_key GROUP BY blob_key) released WHERE b.blob_key = released.blob_key", blobKeys)
+	return err
+}
+
+func (s *Storage) RemoveUnreferencedBlobs(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.removeUnreferencedBlobs(ctx); err != nil {
+				log.Printf("Failed to remove unreferenced blobs: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// removeUnreferencedBlobs deletes blobs without references. The NOT EXISTS
+// check keeps a blob whose counter went wrong from being deleted under an
+// asset that still uses it.
+func (s *Storage) removeUnreferencedBlobs(ctx context.Context) error {
+	rows, err := s.db.Query(ctx, "DELETE FROM blobs b WHERE ref_count <= 0 AND NOT EXISTS (SELECT 1 FROM assets a WHERE a.blob_key = b.blob_key) RETURNING blob_key")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var blobKeys []string
+	for rows.Next() {
+		var blobKey string
+		if err := rows.Scan(&blobKey); err != nil {
+			return err
+		}
+		blobKeys = append(blobKeys, blobKey)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, blobKey := range blobKeys {
+		s.deleteBlob(ctx, blobKey)
+	}
+
+	return nil
+}
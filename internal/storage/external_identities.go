@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+var ErrLoginStateNotFound = errors.New("login state not found")
+var ErrNoFreeLogin = errors.New("no free login")
+
+// CreateOIDCLoginState stores a login redirected to the identity provider.
+// Only the hash of the state is stored.
+func (s *Storage) CreateOIDCLoginState(ctx context.Context, state types.OIDCLoginState) error {
+	_, err := s.db.Exec(ctx, "INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4)", hashToken(state.State), state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	return err
+}
+
+// ConsumeOIDCLoginState returns the login with the state and forgets it, so
+// every callback is accepted once.
+func (s *Storage) ConsumeOIDCLoginState(ctx context.Context, state string) (types.OIDCLoginState, error) {
+	loginState := types.OIDCLoginState{State: state}
+	err := s.db.QueryRow(ctx, "DELETE FROM oidc_login_states WHERE state_hash = $1 RETURNING nonce, code_verifier, expires_at", hashToken(state)).Scan(&loginState.Nonce, &loginState.CodeVerifier, &loginState.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.OIDCLoginState{}, ErrLoginStateNotFound
+		}
+		return types.OIDCLoginState{}, err
+	}
+	if !loginState.ExpiresAt.After(time.Now()) {
+		return types.OIDCLoginState{}, ErrLoginStateNotFound
+	}
+
+	return loginState, nil
+}
+
+// NewExternalSession starts a session for a user authenticated by an identity
+// provider. Users are provisioned on their first login and linked to the
+// provider's subject ID, so later changes of their name at the provider don't
+// matter. Provisioned users have no password. Disabled users fail with
+// ErrAccountDisabled.
+func (s *Storage) NewExternalSession(ctx context.Context, identity types.ExternalIdentity, authData types.AuthData) (types.SessionTokens, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.NewExternalSession tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	var userID int64
+	var disabled bool
+	err = tx.QueryRow(ctx, "SELECT e.uid, u.disabled_at IS NOT NULL FROM external_identities e JOIN users u ON u.id = e.uid WHERE e.issuer = $1 AND e.subject = $2", identity.Issuer, identity.Subject).Scan(&userID, &disabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		userID, err = s.provisionExternalUser(ctx, tx, identity)
+	}
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	if disabled {
+		err = ErrAccountDisabled
+		return types.SessionTokens{}, err
+	}
+
+	tokens, err := s.startSession(ctx, tx, userID, authData)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	return tokens, nil
+}
+
+// provisionExternalUser creates a user without a password for the identity
+// with the first of its logins that isn't taken. It fails with ErrNoFreeLogin
+// if all of them are.
+func (s *Storage) provisionExternalUser(ctx context.Context, tx pgx.Tx, identity types.ExternalIdentity) (int64, error) {
+	var userID int64
+	for _, login := range identity.Logins {
+		err := tx.QueryRow(ctx, "INSERT INTO users (login) VALUES ($1) ON CONFLICT DO NOTHING RETURNING id", login).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO external_identities (issuer, subject, uid) VALUES ($1, $2, $3)", identity.Issuer, identity.Subject, userID)
+		if err != nil {
+			return 0, err
+		}
+
+		log.Printf("Provisioned user %q for subject %q of %s", login, identity.Subject, identity.Issuer)
+		return userID, nil
+	}
+
+	return 0, ErrNoFreeLogin
+}
+
+// ResolveExternalUser returns the local user an access token of the issuer is
+// for. The sub claim is matched against provisioned identities, any other
+// claim against the logins of users provisioned from the issuer, so a token
+// can't act as a local user who merely has the same name. localLogin also
+// allows the login of any local user, for the service accounts the token may
+// act as. Disabled users are reported as ErrUserNotFound.
+func (s *Storage) ResolveExternalUser(ctx context.Context, issuer, claim, value string, localLogin bool) (int64, error) {
+	var userID int64
+	var err error
+	if claim == "sub" {
+		err = s.db.QueryRow(ctx, "SELECT e.uid FROM external_identities e JOIN users u ON u.id = e.uid WHERE e.issuer = $1 AND e.subject = $2 AND u.disabled_at IS NULL", issuer, value).Scan(&userID)
+	} else {
+		err = s.db.QueryRow(ctx, "SELECT u.id FROM users u WHERE u.login = $1 AND u.disabled_at IS NULL AND ($3 OR EXISTS (SELECT 1 FROM external_identities e WHERE e.uid = u.id AND e.issuer = $2))", value, issuer, localLogin).Scan(&userID)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
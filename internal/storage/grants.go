@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+var ErrGrantNotFound = errors.New("grant not found")
+var ErrAccessDenied = errors.New("access denied")
+var ErrGrantToSelf = errors.New("cannot grant access to own assets")
+
+// grantCoversAsset returns the SQL condition matching the asset_grants rows,
+// aliased g, that cover the asset with the owner uid and name given by the two
+// SQL expressions.
+func grantCoversAsset(ownerUID, assetName string) string {
+	return fmt.Sprintf("g.owner_uid = %[1]s AND (g.asset_name = %[2]s OR (g.is_prefix AND starts_with(%[2]s, g.asset_name)))", ownerUID, assetName)
+}
+
+// CreateGrant gives the user with the grantee login access to an asset, or a
+// prefix of asset names, of the owner. Granting the same asset or prefix
+// again replaces the permission.
+func (s *Storage) CreateGrant(ctx context.Context, grant types.AssetGrant) (types.AssetGrant, error) {
+	var granteeID int64
+	err := s.db.QueryRow(ctx, "SELECT id FROM users WHERE login = $1", grant.GranteeLogin).Scan(&granteeID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.AssetGrant{}, ErrUserNotFound
+		}
+		return types.AssetGrant{}, err
+	}
+	if granteeID == grant.OwnerID {
+		return types.AssetGrant{}, ErrGrantToSelf
+	}
+
+	err = s.db.QueryRow(ctx, "INSERT INTO asset_grants (owner_uid, grantee_uid, asset_name, is_prefix, permission) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (owner_uid, grantee_uid, asset_name, is_prefix) DO UPDATE SET permission = EXCLUDED.permission RETURNING id, created_at", grant.OwnerID, granteeID, grant.AssetName, grant.IsPrefix, grant.Permission).Scan(&grant.ID, &grant.CreatedAt)
+	if err != nil {
+		return types.AssetGrant{}, err
+	}
+
+	return grant, nil
+}
+
+// ListGrants returns the grants the owner has given to other users.
+func (s *Storage) ListGrants(ctx context.Context, ownerID int64) ([]types.AssetGrant, error) {
+	rows, err := s.db.Query(ctx, "SELECT g.id, g.owner_uid, u.login, g.asset_name, g.is_prefix, g.permission, g.created_at FROM asset_grants g JOIN users u ON u.id = g.grantee_uid WHERE g.owner_uid = $1 ORDER BY g.created_at DESC", ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []types.AssetGrant
+	for rows.Next() {
+		var grant types.AssetGrant
+		err := rows.Scan(&grant.ID, &grant.OwnerID, &grant.GranteeLogin, &grant.AssetName, &grant.IsPrefix, &grant.Permission, &grant.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+// DeleteGrant revokes a grant the owner has given.
+func (s *Storage) DeleteGrant(ctx context.Context, ownerID, grantID int64) error {
+	result, err := s.db.Exec(ctx, "DELETE FROM asset_grants WHERE id = $1 AND owner_uid = $2", grantID, ownerID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrGrantNotFound
+	}
+
+	return nil
+}
+
+// ResolveAssetOwner returns the uid of the namespace the user accesses an
+// asset in. An empty owner login is the user's own namespace; any other owner
+// must have granted the user access to the asset, read-write access if write
+// is set. Unknown owners are reported as ErrAccessDenied as well so logins
+// can't be probed.
+func (s *Storage) ResolveAssetOwner(ctx context.Context, userID int64, ownerLogin, assetName string, write bool) (int64, error) {
+	if ownerLogin == "" {
+		return userID, nil
+	}
+
+	var ownerID int64
+	err := s.db.QueryRow(ctx, "SELECT id FROM users WHERE login = $1", ownerLogin).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrAccessDenied
+		}
+		return 0, err
+	}
+	if ownerID == userID {
+		return ownerID, nil
+	}
+
+	permissions := []string{types.PermissionReadWrite}
+	if !write {
+		permissions = append(permissions, types.PermissionRead)
+	}
+
+	var allowed bool
+	err = s.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM asset_grants g WHERE g.grantee_uid = $1 AND g.permission = ANY($4) AND "+grantCoversAsset("$2", "$3")+")", userID, ownerID, assetName, permissions).Scan(&allowed)
+	if err != nil {
+		return 0, err
+	}
+	if !allowed {
+		return 0, ErrAccessDenied
+	}
+
+	return ownerID, nil
+}
+
+// GetSharedAssetsList returns the latest versions of the assets other users
+// have shared with the user.
+func (s *Storage) GetSharedAssetsList(ctx context.Context, userID int64, limit, offset int) ([]types.Asset, error) {
+	return s.listLatestAssets(ctx, "EXISTS (SELECT 1 FROM asset_grants g WHERE g.grantee_uid = $1 AND "+grantCoversAsset("assets.uid", "assets.name")+")", userID, limit, offset)
+}
+
+// revokeAssetGrants removes the grants for an asset whose last version has
+// been deleted, see revokeAssetAccess.
+func (s *Storage) revokeAssetGrants(ctx context.Context, tx pgx.Tx, ownerID int64, assetName string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM asset_grants WHERE owner_uid = $1 AND asset_name = $2 AND NOT is_prefix AND NOT EXISTS (SELECT 1 FROM assets WHERE uid = $1 AND name = $2)", ownerID, assetName)
+	return err
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	loginLockoutKindAccount   = "account"
+	loginLockoutKindIP        = "ip"
+	loginLockoutKindShareLink = "share_link"
+)
+
+// LoginThrottledError is returned for logins attempted while the account or
+// the address is backing off or locked out, and for password reset requests
+// from an address that made too many.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts"
+}
+
+// loginLimits are the login throttling thresholds, see config.AuthConfig.
+type loginLimits struct {
+	backoffAfter    int
+	backoffBase     time.Duration
+	lockoutAfter    int
+	ipLockoutAfter  int
+	lockoutDuration time.Duration
+}
+
+// throttleKey is a subject failed attempts are counted against.
+type throttleKey struct {
+	key          string
+	kind         string
+	subject      string
+	lockoutAfter int
+}
+
+// loginAttempt is an attempt reserved with reserveAttempt. It is counted as
+// a failure before the credentials are checked, so concurrent attempts can't
+// all get through before the first failure is recorded. An attempt that turns
+// out not to have failed is taken back with release.
+type loginAttempt struct {
+	s        *Storage
+	keys     []throttleKey
+	failures []int
+	locks    []*time.Time
+	done     bool
+}
+
+// reserveLoginAttempt reserves a login attempt to the account from the
+// address. It fails with a LoginThrottledError if either has to wait.
+func (s *Storage) reserveLoginAttempt(ctx context.Context, login, ipAddress string) (*loginAttempt, error) {
+	return s.reserveAttempt(ctx,
+		throttleKey{key: accountLoginKey(login), kind: loginLockoutKindAccount, subject: login, lockoutAfter: s.loginLimits.lockoutAfter},
+		throttleKey{key: ipLoginKey(ipAddress), kind: loginLockoutKindIP, subject: ipAddress, lockoutAfter: s.loginLimits.ipLockoutAfter},
+	)
+}
+
+// reserveSharePasswordAttempt reserves an attempt to open the password
+// protected share link from the address. Guessing link passwords and logins
+// count towards the same address limit.
+func (s *Storage) reserveSharePasswordAttempt(ctx context.Context, linkID, ipAddress string) (*loginAttempt, error) {
+	return s.reserveAttempt(ctx,
+		throttleKey{key: shareLinkLoginKey(linkID), kind: loginLockoutKindShareLink, subject: linkID, lockoutAfter: s.loginLimits.lockoutAfter},
+		throttleKey{key: ipLoginKey(ipAddress), kind: loginLockoutKindIP, subject: ipAddress, lockoutAfter: s.loginLimits.ipLockoutAfter},
+	)
+}
+
+// reserveAttempt counts a failure against every key in order and sets how
+// long the key has to wait if the attempt fails. Keys that are waiting
+// already reject the attempt with a LoginThrottledError, and the keys reserved
+// before are released.
+func (s *Storage) reserveAttempt(ctx context.Context, keys ...throttleKey) (*loginAttempt, error) {
+	attempt := &loginAttempt{s: s}
+	for _, key := range keys {
+		failures, lockedUntil, err := s.reserveThrottleKey(ctx, key)
+		if err != nil {
+			attempt.release(ctx)
+			return nil, err
+		}
+		attempt.keys = append(attempt.keys, key)
+		attempt.failures = append(attempt.failures, failures)
+		attempt.locks = append(attempt.locks, lockedUntil)
+	}
+
+	return attempt, nil
+}
+
+// reserveThrottleKey increments the failures of the key unless it has to
+// wait. The row stays locked until the wait is set, so concurrent attempts
+// for the same key are counted one after the other and see the wait set by
+// the previous one.
+func (s *Storage) reserveThrottleKey(ctx context.Context, key throttleKey) (failures int, lockedUntil *time.Time, err error) {
+	limits := s.loginLimits
+	now := time.Now()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.reserveThrottleKey tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	err = tx.QueryRow(ctx, "INSERT INTO login_failures (key, failures, last_failure_at) VALUES ($1, 1, $2) ON CONFLICT (key) DO UPDATE SET failures = CASE WHEN login_failures.last_failure_at < $3 THEN 1 ELSE login_failures.failures + 1 END, last_failure_at = EXCLUDED.last_failure_at WHERE login_failures.locked_until IS NULL OR login_failures.locked_until <= $2 RETURNING failures", key.key, now, now.Add(-limits.lockoutDuration)).Scan(&failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var waitUntil time.Time
+		if err = tx.QueryRow(ctx, "SELECT locked_until FROM login_failures WHERE key = $1", key.key).Scan(&waitUntil); err != nil {
+			return 0, nil, err
+		}
+		err = &LoginThrottledError{RetryAfter: waitUntil.Sub(now)}
+		return 0, nil, err
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var wait time.Duration
+	if failures >= key.lockoutAfter {
+		wait = limits.lockoutDuration
+	} else if failures >= limits.backoffAfter {
+		wait = limits.backoffBase << (failures - limits.backoffAfter)
+		if wait <= 0 || wait > limits.lockoutDuration {
+			wait = limits.lockoutDuration
+		}
+	}
+	if wait > 0 {
+		// Rounded to what the column stores, so release can recognize it.
+		until := now.Add(wait).Truncate(time.Microsecond)
+		lockedUntil = &until
+		if _, err = tx.Exec(ctx, "UPDATE login_failures SET locked_until = $2 WHERE key = $1", key.key, until); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, nil, err
+	}
+
+	return failures, lockedUntil, nil
+}
+
+// fail keeps the failures counted by the reservation. The failure that
+// reaches a lockout threshold records the lockout for administrators.
+func (a *loginAttempt) fail(ctx context.Context) {
+	if a.done {
+		return
+	}
+	a.done = true
+
+	ctx = context.WithoutCancel(ctx)
+	for i, key := range a.keys {
+		if a.failures[i] != key.lockoutAfter || a.locks[i] == nil {
+			continue
+		}
+		_, err := a.s.db.Exec(ctx, "INSERT INTO login_lockouts (kind, subject, failures, locked_until) VALUES ($1, $2, $3, $4)", key.kind, key.subject, a.failures[i], *a.locks[i])
+		if err != nil {
+			log.Printf("storage.loginAttempt.fail error: %v", err)
+			continue
+		}
+		log.Printf("Login locked out for %s %q until %s after %d failures", key.kind, key.subject, a.locks[i].Format(time.RFC3339), a.failures[i])
+	}
+}
+
+// release takes back the failures counted by the reservation, including the
+// wait it set unless a later attempt has set another one meanwhile. Keys
+// cleared after a success are not recreated. It does nothing after fail or a
+// previous release, so it can be deferred.
+func (a *loginAttempt) release(ctx context.Context) {
+	if a.done {
+		return
+	}
+	a.done = true
+
+	ctx = context.WithoutCancel(ctx)
+	for i, key := range a.keys {
+		_, err := a.s.db.Exec(ctx, "UPDATE login_failures SET failures = GREATEST(failures - 1, 0), locked_until = CASE WHEN locked_until = $2 THEN NULL ELSE locked_until END WHERE key = $1", key.key, a.locks[i])
+		if err != nil {
+			log.Printf("storage.loginAttempt.release error: %v", err)
+		}
+	}
+}
+
+// clearLoginFailures forgets the failures of the account after a successful
+// login. Failures from the address are kept, it may be trying other accounts.
+func (s *Storage) clearLoginFailures(ctx context.Context, tx pgx.Tx, login string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM login_failures WHERE key = $1", accountLoginKey(login))
+	return err
+}
+
+// RemoveStaleLoginFailures periodically forgets failures and password reset
+// requests that no longer count.
+func (s *Storage) RemoveStaleLoginFailures(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := s.db.Exec(ctx, "DELETE FROM login_failures WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= now())", time.Now().Add(-s.loginLimits.lockoutDuration))
+			if err != nil {
+				log.Printf("Failed to remove stale login failures: %v", err)
+			}
+			_, err = s.db.Exec(ctx, "DELETE FROM password_reset_requests WHERE requested_at < $1", time.Now().Add(-passwordResetWindow))
+			if err != nil {
+				log.Printf("Failed to remove stale password reset requests: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func accountLoginKey(login string) string {
+	return "login:" + login
+}
+
+func ipLoginKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+func shareLinkLoginKey(linkID string) string {
+	return "share:" + linkID
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+const MULTIPART_UPLOAD_EXPIRATION = 24 * time.Hour
+
+var ErrMultipartUploadNotFound = errors.New("multipart upload not found")
+var ErrInvalidPart = errors.New("invalid part")
+var ErrInvalidPartOrder = errors.New("invalid part order")
+
+func (s *Storage) CreateMultipartUpload(ctx context.Context, upload types.MultipartUpload) (types.MultipartUpload, error) {
+	err := s.checkAssetCanBeCreated(ctx, upload.UserID, upload.AssetName)
+	if err != nil {
+		return types.MultipartUpload{}, err
+	}
+
+	upload.ID, err = generateToken()
+	if err != nil {
+		return types.MultipartUpload{}, err
+	}
+	upload.ExpiresAt = time.Now().Add(MULTIPART_UPLOAD_EXPIRATION)
+
+	err = s.db.QueryRow(ctx, "INSERT INTO multipart_uploads (id, uid, asset_name, original_name, content_type, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at", upload.ID, upload.UserID, upload.AssetName, upload.OriginalName, upload.ContentType, upload.ExpiresAt).Scan(&upload.CreatedAt)
+	if err != nil {
+		return types.MultipartUpload{}, err
+	}
+
+	return upload, nil
+}
+
+// UploadPart stores a part of a multipart upload. Uploading a part number
+// again replaces the previous content. The part ETag is the MD5 of its bytes.
+// The parts staged for one upload may not exceed maxSize in total, the
+// largest asset the upload could be completed into.
+func (s *Storage) UploadPart(ctx context.Context, userID int64, assetName, uploadID string, partNumber int, body io.Reader, maxSize int64) (types.UploadPart, error) {
+	if _, err := s.getMultipartUpload(ctx, userID, assetName, uploadID); err != nil {
+		return types.UploadPart{}, err
+	}
+
+	stagedSize, err := s.stagedPartsSize(ctx, s.db, uploadID, partNumber)
+	if err != nil {
+		return types.UploadPart{}, err
+	}
+	if stagedSize >= maxSize {
+		return types.UploadPart{}, ErrAssetTooLarge
+	}
+
+	// Reading one byte more than allowed tells an oversized part apart from
+	// one that fills the remaining space exactly.
+	hash := md5.New()
+	blobKey, size, err := s.blobs.Put(ctx, io.TeeReader(io.LimitReader(body, maxSize-stagedSize+1), hash))
+	if err != nil {
+		return types.UploadPart{}, err
+	}
+	if size > maxSize-stagedSize {
+		s.deleteBlob(ctx, blobKey)
+		return types.UploadPart{}, ErrAssetTooLarge
+	}
+
+	part := types.UploadPart{
+		PartNumber: partNumber,
+		ETag:       hex.EncodeToString(hash.Sum(nil)),
+		Size:       size,
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.deleteBlob(ctx, blobKey)
+		return types.UploadPart{}, err
+	}
+	defer func() {
+		if err != nil {
+			s.deleteBlob(ctx, blobKey)
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.UploadPart tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	// The row lock taken here serializes part uploads of the same upload, so
+	// the statements below see the parts committed by concurrent requests.
+	result, err := tx.Exec(ctx, "UPDATE multipart_uploads SET expires_at = $1 WHERE id = $2 AND expires_at > now()", time.Now().Add(MULTIPART_UPLOAD_EXPIRATION), uploadID)
+	if err != nil {
+		return types.UploadPart{}, err
+	}
+	if result.RowsAffected() == 0 {
+		err = ErrMultipartUploadNotFound
+		return types.UploadPart{}, err
+	}
+
+	stagedSize, err = s.stagedPartsSize(ctx, tx, uploadID, partNumber)
+	if err != nil {
+		return types.UploadPart{}, err
+	}
+	if stagedSize+size > maxSize {
+		err = ErrAssetTooLarge
+		return types.UploadPart{}, err
+	}
+
+	var replacedBlobKeys []string
+	rows, err := tx.Query(ctx, "DELETE FROM multipart_upload_parts WHERE upload_id = $1 AND part_number = $2 RETURNING blob_key", uploadID, partNumber)
+	if err != nil {
+		return types.UploadPart{}, err
+	}
+	for rows.Next() {
+		var replacedBlobKey string
+		if err = rows.Scan(&replacedBlobKey); err != nil {
+			rows.Close()
+			return types.UploadPart{}, err
+		}
+		replacedBlobKeys = append(replacedBlobKeys, replacedBlobKey)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return types.UploadPart{}, err
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO multipart_upload_parts (upload_id, part_number, etag, size, blob_key) VALUES ($1, $2, $3, $4, $5) RETURNING created_at", uploadID, partNumber, part.ETag, part.Size, blobKey).Scan(&part.CreatedAt)
+	if err != nil {
+		return types.UploadPart{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.UploadPart{}, err
+	}
+
+	for _, replacedBlobKey := range replacedBlobKeys {
+		s.deleteBlob(ctx, replacedBlobKey)
+	}
+
+	return part, nil
+}
+
+// stagedPartsSize returns the total size of the parts of the upload other
+// than partNumber, which is about to be replaced.
+func (s *Storage) stagedPartsSize(ctx context.Context, q queryRower, uploadID string, partNumber int) (int64, error) {
+	var size int64
+	err := q.QueryRow(ctx, "SELECT COALESCE(SUM(size), 0) FROM multipart_upload_parts WHERE upload_id = $1 AND part_number <> $2", uploadID, partNumber).Scan(&size)
+	return size, err
+}
+
+func (s *Storage) ListUploadParts(ctx context.Context, userID int64, assetName, uploadID string) ([]types.UploadPart, error) {
+	if _, err := s.getMultipartUpload(ctx, userID, assetName, uploadID); err != nil {
+		return nil, err
+	}
+
+	parts, _, err := s.multipartUploadParts(ctx, uploadID)
+	return parts, err
+}
+
+// CompleteMultipartUpload concatenates the listed parts into the asset and
+// removes the upload. Parts must be listed in ascending order with the ETags
+// returned by UploadPart; parts that are not listed are discarded.
+func (s *Storage) CompleteMultipartUpload(ctx context.Context, userID int64, assetName, uploadID string, parts []types.UploadPart, maxSize int64) error {
+	upload, err := s.getMultipartUpload(ctx, userID, assetName, uploadID)
+	if err != nil {
+		return err
+	}
+
+	storedParts, blobKeys, err := s.multipartUploadParts(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+
+	storedByNumber := make(map[int]int, len(storedParts))
+	for i, part := range storedParts {
+		storedByNumber[part.PartNumber] = i
+	}
+
+	if len(parts) == 0 {
+		return ErrInvalidPart
+	}
+
+	var size int64
+	partKeys := make([]string, 0, len(parts))
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return ErrInvalidPartOrder
+		}
+
+		stored, ok := storedByNumber[part.PartNumber]
+		if !ok || storedParts[stored].ETag != part.ETag {
+			return ErrInvalidPart
+		}
+
+		size += storedParts[stored].Size
+		partKeys = append(partKeys, blobKeys[stored])
+	}
+	if size > maxSize {
+		return ErrAssetTooLarge
+	}
+
+	body := newBlobChain(ctx, s.blobs, partKeys)
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Printf("storage.CompleteMultipartUpload body.Close error: %v", err)
+		}
+	}()
+
+	_, err = s.UploadAsset(ctx, types.UploadAssetData{
+		UserID:       upload.UserID,
+		AssetName:    upload.AssetName,
+		OriginalName: upload.OriginalName,
+		ContentType:  upload.ContentType,
+		Body:         body,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.AbortMultipartUpload(ctx, userID, assetName, uploadID)
+}
+
+// AbortMultipartUpload removes the upload and all of its parts.
+func (s *Storage) AbortMultipartUpload(ctx context.Context, userID int64, assetName, uploadID string) error {
+	deleted, blobKeys, err := s.deleteMultipartUploads(ctx, "id = $1 AND uid = $2 AND asset_name = $3", uploadID, userID, assetName)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrMultipartUploadNotFound
+	}
+
+	for _, blobKey := range blobKeys {
+		s.deleteBlob(ctx, blobKey)
+	}
+
+	return nil
+}
+
+// RemoveExpiredMultipartUploads periodically reaps multipart uploads that
+// received no parts for MULTIPART_UPLOAD_EXPIRATION.
+func (s *Storage) RemoveExpiredMultipartUploads(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, blobKeys, err := s.deleteMultipartUploads(ctx, "expires_at <= now()")
+			if err != nil {
+				log.Printf("Failed to remove expired multipart uploads: %v", err)
+				continue
+			}
+			for _, blobKey := range blobKeys {
+				s.deleteBlob(ctx, blobKey)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Storage) getMultipartUpload(ctx context.Context, userID int64, assetName, uploadID string) (types.MultipartUpload, error) {
+	var upload types.MultipartUpload
+	var originalName *string
+	err := s.db.QueryRow(ctx, "SELECT id, uid, asset_name, original_name, content_type, created_at, expires_at FROM multipart_uploads WHERE id = $1 AND uid = $2 AND asset_name = $3 AND expires_at > now()", uploadID, userID, assetName).Scan(&upload.ID, &upload.UserID, &upload.AssetName, &originalName, &upload.ContentType, &upload.CreatedAt, &upload.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.MultipartUpload{}, ErrMultipartUploadNotFound
+		}
+		return types.MultipartUpload{}, err
+	}
+	if originalName != nil {
+		upload.OriginalName = *originalName
+	}
+
+	return upload, nil
+}
+
+// multipartUploadParts returns the parts ordered by number along with their
+// blob keys.
+func (s *Storage) multipartUploadParts(ctx context.Context, uploadID string) ([]types.UploadPart, []string, error) {
+	rows, err := s.db.Query(ctx, "SELECT part_number, etag, size, created_at, blob_key FROM multipart_upload_parts WHERE upload_id = $1 ORDER BY part_number", uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	parts := []types.UploadPart{}
+	var blobKeys []string
+	for rows.Next() {
+		var part types.UploadPart
+		var blobKey string
+		if err := rows.Scan(&part.PartNumber, &part.ETag, &part.Size, &part.CreatedAt, &blobKey); err != nil {
+			return nil, nil, err
+		}
+		parts = append(parts, part)
+		blobKeys = append(blobKeys, blobKey)
+	}
+
+	return parts, blobKeys, rows.Err()
+}
+
+func (s *Storage) deleteMultipartUploads(ctx context.Context, condition string, args ...interface{}) (int, []string, error) {
+	return s.deleteStagedUploads(ctx, "multipart_uploads", "multipart_upload_parts", condition, args...)
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+var ErrOrganizationAlreadyExists = errors.New("organization already exists")
+var ErrOrganizationNotFound = errors.New("organization not found")
+var ErrMemberNotFound = errors.New("organization member not found")
+var ErrLastOwner = errors.New("organization must keep an owner")
+
+// queryRower, execer and queryExecer are implemented by both the pool and
+// transactions.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+type queryExecer interface {
+	queryRower
+	execer
+}
+
+// CreateOrganization creates an organization with the user as its owner.
+func (s *Storage) CreateOrganization(ctx context.Context, userID int64, name string) (types.Organization, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return types.Organization{}, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.CreateOrganization tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	org := types.Organization{Name: name, Role: types.RoleOwner}
+	err = tx.QueryRow(ctx, "INSERT INTO organizations (name) VALUES ($1) RETURNING id, created_at", name).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.UniqueViolation {
+			err = ErrOrganizationAlreadyExists
+		}
+		return types.Organization{}, err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO organization_members (org_id, uid, role) VALUES ($1, $2, $3)", org.ID, userID, types.RoleOwner)
+	if err != nil {
+		return types.Organization{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.Organization{}, err
+	}
+
+	return org, nil
+}
+
+// ListOrganizations returns the organizations the user is a member of.
+func (s *Storage) ListOrganizations(ctx context.Context, userID int64) ([]types.Organization, error) {
+	rows, err := s.db.Query(ctx, "SELECT o.id, o.name, m.role, o.created_at FROM organizations o JOIN organization_members m ON m.org_id = o.id WHERE m.uid = $1 ORDER BY o.name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []types.Organization
+	for rows.Next() {
+		var org types.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Role, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// ListOrganizationMembers returns the members of an organization the user
+// belongs to.
+func (s *Storage) ListOrganizationMembers(ctx context.Context, userID int64, orgName string) ([]types.OrganizationMember, error) {
+	org, err := s.getOrganization(ctx, s.db, userID, orgName)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, "SELECT u.login, m.role, m.created_at FROM organization_members m JOIN users u ON u.id = m.uid WHERE m.org_id = $1 ORDER BY u.login", org.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []types.OrganizationMember
+	for rows.Next() {
+		var member types.OrganizationMember
+		if err := rows.Scan(&member.Login, &member.Role, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// SetOrganizationMember adds the user with the login to the organization or
+// changes their role. Only owners can manage members.
+func (s *Storage) SetOrganizationMember(ctx context.Context, userID int64, orgName, login, role string) error {
+	return s.changeOrganizationMember(ctx, "storage.SetOrganizationMember", userID, orgName, login, func(tx pgx.Tx, orgID, memberID int64) error {
+		_, err := tx.Exec(ctx, "INSERT INTO organization_members (org_id, uid, role) VALUES ($1, $2, $3) ON CONFLICT (org_id, uid) DO UPDATE SET role = EXCLUDED.role", orgID, memberID, role)
+		return err
+	})
+}
+
+// RemoveOrganizationMember removes the user with the login from the
+// organization. Owners can remove anyone, other members only themselves.
+func (s *Storage) RemoveOrganizationMember(ctx context.Context, userID int64, orgName, login string) error {
+	return s.changeOrganizationMember(ctx, "storage.RemoveOrganizationMember", userID, orgName, login, func(tx pgx.Tx, orgID, memberID int64) error {
+		result, err := tx.Exec(ctx, "DELETE FROM organization_members WHERE org_id = $1 AND uid = $2", orgID, memberID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return ErrMemberNotFound
+		}
+		return nil
+	})
+}
+
+// changeOrganizationMember applies a membership change made by the user and
+// fails with ErrLastOwner if it leaves the organization without an owner.
+// Changes to organizations the user doesn't belong to fail with
+// ErrOrganizationNotFound, changes they may not make with ErrAccessDenied.
+func (s *Storage) changeOrganizationMember(ctx context.Context, operation string, userID int64, orgName, login string, change func(tx pgx.Tx, orgID, memberID int64) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("%s tx.Rollback error: %v", operation, errRollback)
+			}
+		}
+	}()
+
+	// Membership changes of an organization are serialized so two owners
+	// can't demote each other at the same time.
+	_, err = tx.Exec(ctx, "SELECT 1 FROM organizations WHERE name = $1 FOR UPDATE", orgName)
+	if err != nil {
+		return err
+	}
+
+	org, err := s.getOrganization(ctx, tx, userID, orgName)
+	if err != nil {
+		return err
+	}
+
+	var memberID int64
+	err = tx.QueryRow(ctx, "SELECT id FROM users WHERE login = $1", login).Scan(&memberID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = ErrUserNotFound
+		}
+		return err
+	}
+
+	if org.Role != types.RoleOwner && memberID != userID {
+		err = ErrAccessDenied
+		return err
+	}
+
+	if err = change(tx, org.ID, memberID); err != nil {
+		return err
+	}
+
+	var hasOwner bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM organization_members WHERE org_id = $1 AND role = $2)", org.ID, types.RoleOwner).Scan(&hasOwner)
+	if err != nil {
+		return err
+	}
+	if !hasOwner {
+		err = ErrLastOwner
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ResolveOrganizationNamespace returns the namespace ID of the organization
+// if the user's role allows reading its assets, or writing them if write is
+// set. Unknown organizations are reported as ErrAccessDenied as well so
+// names can't be probed.
+func (s *Storage) ResolveOrganizationNamespace(ctx context.Context, userID int64, orgName string, write bool) (int64, error) {
+	org, err := s.getOrganization(ctx, s.db, userID, orgName)
+	if err != nil {
+		if errors.Is(err, ErrOrganizationNotFound) {
+			return 0, ErrAccessDenied
+		}
+		return 0, err
+	}
+
+	if write && org.Role == types.RoleViewer {
+		return 0, ErrAccessDenied
+	}
+
+	return org.ID, nil
+}
+
+// GetOrganizationAssetsList returns the latest versions of the assets in the
+// organization namespace.
+func (s *Storage) GetOrganizationAssetsList(ctx context.Context, orgID int64, limit, offset int) ([]types.Asset, error) {
+	return s.listLatestAssets(ctx, "uid = $1", orgID, limit, offset)
+}
+
+// getOrganization looks the organization up together with the user's role in
+// it. Organizations the user isn't a member of are reported as
+// ErrOrganizationNotFound.
+func (s *Storage) getOrganization(ctx context.Context, q queryRower, userID int64, orgName string) (types.Organization, error) {
+	org := types.Organization{Name: orgName}
+	err := q.QueryRow(ctx, "SELECT o.id, m.role, o.created_at FROM organizations o JOIN organization_members m ON m.org_id = o.id WHERE o.name = $1 AND m.uid = $2", orgName, userID).Scan(&org.ID, &org.Role, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.Organization{}, ErrOrganizationNotFound
+		}
+		return types.Organization{}, err
+	}
+
+	return org, nil
+}
@@ -8,20 +8,32 @@ import (
 	"fmt"
 	"github.com/jackc/pgx/v4"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/ArturV19/file-storage/internal/types"
 )
 
-const SESSION_DURATION = 24 * time.Hour
-
 var ErrInvalidLoginPassword = errors.New("invalid login/password")
 var ErrInvalidToken = errors.New("invalid token")
+var ErrSessionNotFound = errors.New("session not found")
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// NewSession logs the user in and starts a new session. Sessions are
+// independent, logging in again doesn't affect the other devices. Logins are
+// throttled after repeated failures, see LoginThrottledError. Users with
+// two-factor authentication get a TwoFactorRequiredError instead of a session
+// and finish the login with CompleteTwoFactorLogin.
+func (s *Storage) NewSession(ctx context.Context, authData types.AuthData) (types.SessionTokens, error) {
+	attempt, err := s.reserveLoginAttempt(ctx, authData.Login, authData.IPAddress)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	defer attempt.release(ctx)
 
-func (s *Storage) NewSession(ctx context.Context, authData types.AuthData) (string, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return "", err
+		return types.SessionTokens{}, err
 	}
 	defer func() {
 		if err != nil {
@@ -31,61 +43,248 @@ func (s *Storage) NewSession(ctx context.Context, authData types.AuthData) (stri
 		}
 	}()
 
+	userID, err := s.verifyPassword(ctx, tx, authData.Login, authData.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidLoginPassword) {
+			attempt.fail(ctx)
+		}
+		return types.SessionTokens{}, err
+	}
+
+	var twoFactorEnabled bool
+	err = tx.QueryRow(ctx, "SELECT totp_enabled FROM users WHERE id = $1", userID).Scan(&twoFactorEnabled)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	if twoFactorEnabled {
+		var challengeToken string
+		challengeToken, err = s.createTwoFactorChallenge(ctx, tx, userID)
+		if err != nil {
+			return types.SessionTokens{}, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return types.SessionTokens{}, err
+		}
+		return types.SessionTokens{}, &TwoFactorRequiredError{ChallengeToken: challengeToken}
+	}
+
+	if err = s.clearLoginFailures(ctx, tx, authData.Login); err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	tokens, err := s.startSession(ctx, tx, userID, authData)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	return tokens, nil
+}
+
+// startSession creates the session and its first refresh token.
+func (s *Storage) startSession(ctx context.Context, tx pgx.Tx, userID int64, authData types.AuthData) (types.SessionTokens, error) {
+	token, err := generateToken()
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.accessTokenTTL)
+	refreshExpiresAt := now.Add(s.refreshTokenTTL)
+
+	var userAgent *string
+	if authData.UserAgent != "" {
+		userAgent = &authData.UserAgent
+	}
+
+	var sessionID string
+	err = tx.QueryRow(ctx, "INSERT INTO sessions (id, uid, ip_address, user_agent, expires_at, refresh_expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING public_id", token, userID, authData.IPAddress, userAgent, expiresAt, refreshExpiresAt).Scan(&sessionID)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx, tx, sessionID)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	return types.SessionTokens{
+		UserID:       userID,
+		SessionID:    sessionID,
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// RefreshSession trades a refresh token for a new session token and the next
+// refresh token of the session. Presenting a refresh token that was already
+// used means it leaked, so the whole session is revoked and
+// ErrRefreshTokenReused is returned.
+func (s *Storage) RefreshSession(ctx context.Context, refreshToken string) (types.SessionTokens, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.RefreshSession tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	tokenHash := hashToken(refreshToken)
+
 	var userID int64
-	err = tx.QueryRow(ctx, "SELECT id FROM users WHERE login = $1 AND password_hash = $2", authData.Login, hashPassword(authData.Password)).Scan(&userID)
+	var sessionID string
+	var used, active bool
+	err = tx.QueryRow(ctx, "SELECT s.uid, r.session_id, r.used_at IS NOT NULL, s.refresh_expires_at > now() FROM refresh_tokens r JOIN sessions s ON s.public_id = r.session_id WHERE r.token_hash = $1 FOR UPDATE OF r, s", tokenHash).Scan(&userID, &sessionID, &used, &active)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", ErrInvalidLoginPassword
+			err = ErrInvalidToken
 		}
-		return "", err
+		return types.SessionTokens{}, err
 	}
 
-	var token string
-	err = tx.QueryRow(ctx, "SELECT id FROM sessions WHERE uid = $1 AND expires_at > now()", userID).Scan(&token)
-	if err == nil {
-		if errCommit := tx.Commit(ctx); errCommit != nil {
-			return "", errCommit
+	if used {
+		if _, err = s.deleteSessions(ctx, tx, "public_id = $2", sessionID); err != nil {
+			return types.SessionTokens{}, err
 		}
-		return token, nil
+		if err = tx.Commit(ctx); err != nil {
+			return types.SessionTokens{}, err
+		}
+		return types.SessionTokens{}, ErrRefreshTokenReused
 	}
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		return "", err
+
+	if !active {
+		err = ErrInvalidToken
+		return types.SessionTokens{}, err
 	}
 
-	_, err = tx.Exec(ctx, "DELETE FROM sessions WHERE uid = $1", userID)
-	if err != nil {
-		return "", err
+	if _, err = tx.Exec(ctx, "UPDATE refresh_tokens SET used_at = now() WHERE token_hash = $1", tokenHash); err != nil {
+		return types.SessionTokens{}, err
 	}
 
-	token, err = generateToken()
+	token, err := generateToken()
 	if err != nil {
-		return "", err
+		return types.SessionTokens{}, err
 	}
+	expiresAt := time.Now().Add(s.accessTokenTTL)
 
-	expiresAt := time.Now().Add(SESSION_DURATION)
+	if _, err = tx.Exec(ctx, "UPDATE sessions SET id = $1, expires_at = $2 WHERE public_id = $3", token, expiresAt, sessionID); err != nil {
+		return types.SessionTokens{}, err
+	}
 
-	_, err = tx.Exec(ctx, "INSERT INTO sessions (id, uid, ip_address, expires_at) VALUES ($1, $2, $3, $4)", token, userID, authData.IPAddress, expiresAt)
+	nextRefreshToken, err := s.issueRefreshToken(ctx, tx, sessionID)
 	if err != nil {
-		return "", err
+		return types.SessionTokens{}, err
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		return "", err
+		return types.SessionTokens{}, err
 	}
 
-	return token, nil
+	return types.SessionTokens{
+		UserID:       userID,
+		SessionID:    sessionID,
+		AccessToken:  token,
+		RefreshToken: nextRefreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
 }
 
-func (s *Storage) ValidateToken(ctx context.Context, token string) (int64, error) {
+// ValidateToken returns the user and the public session ID of a session
+// token. With sliding sessions every use extends the token by the access token
+// lifetime.
+func (s *Storage) ValidateToken(ctx context.Context, token string) (int64, string, error) {
 	var userID int64
-	err := s.db.QueryRow(ctx, "SELECT uid FROM sessions WHERE id = $1 AND expires_at > now()", token).Scan(&userID)
+	var sessionID string
+	var err error
+	if s.slidingSessions {
+		err = s.db.QueryRow(ctx, "UPDATE sessions SET expires_at = $2 WHERE id = $1 AND expires_at > now() RETURNING uid, public_id", token, time.Now().Add(s.accessTokenTTL)).Scan(&userID, &sessionID)
+	} else {
+		err = s.db.QueryRow(ctx, "SELECT uid, public_id FROM sessions WHERE id = $1 AND expires_at > now()", token).Scan(&userID, &sessionID)
+	}
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, ErrInvalidToken
+			return 0, "", ErrInvalidToken
 		}
-		return 0, err
+		return 0, "", err
 	}
-	return userID, nil
+	return userID, sessionID, nil
+}
+
+// ListSessions returns the active sessions of the user, marking the current
+// one.
+func (s *Storage) ListSessions(ctx context.Context, userID int64, currentSessionID string) ([]types.Session, error) {
+	rows, err := s.db.Query(ctx, "SELECT public_id, COALESCE(host(ip_address), ''), COALESCE(user_agent, ''), created_at, expires_at, public_id = $2 FROM sessions WHERE uid = $1 AND GREATEST(expires_at, refresh_expires_at) > now() ORDER BY created_at DESC", userID, currentSessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []types.Session
+	for rows.Next() {
+		var session types.Session
+		err := rows.Scan(&session.ID, &session.IPAddress, &session.UserAgent, &session.CreatedAt, &session.ExpiresAt, &session.Current)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes a session of the user by its public ID.
+func (s *Storage) DeleteSession(ctx context.Context, userID int64, sessionID string) error {
+	deleted, err := s.deleteSessions(ctx, s.db, "public_id = $2 AND uid = $3", sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteOtherSessions revokes every session of the user except the current
+// one.
+func (s *Storage) DeleteOtherSessions(ctx context.Context, userID int64, currentSessionID string) error {
+	_, err := s.deleteSessions(ctx, s.db, "uid = $2 AND public_id <> $3", userID, currentSessionID)
+	return err
+}
+
+// Logout revokes the current session.
+func (s *Storage) Logout(ctx context.Context, sessionID string) error {
+	_, err := s.deleteSessions(ctx, s.db, "public_id = $2", sessionID)
+	return err
+}
+
+// ListRevokedSessions returns the IDs of the sessions that were revoked while
+// signed access tokens issued for them may still be valid.
+func (s *Storage) ListRevokedSessions(ctx context.Context) ([]string, error) {
+	rows, err := s.db.Query(ctx, "SELECT session_id FROM revoked_sessions WHERE expires_at > now()")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessionIDs []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, err
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+
+	return sessionIDs, rows.Err()
 }
 
 func (s *Storage) RemoveExpiredSessions(ctx context.Context) {
@@ -95,16 +294,122 @@ func (s *Storage) RemoveExpiredSessions(ctx context.Context) {
 	for {
 		select {
 		case <-ticker.C:
-			_, err := s.db.Exec(ctx, "DELETE FROM sessions WHERE expires_at <= now()")
+			_, err := s.db.Exec(ctx, "DELETE FROM sessions WHERE GREATEST(expires_at, refresh_expires_at) <= now()")
 			if err != nil {
 				log.Printf("Failed to remove expired sessions: %v", err)
 			}
+			_, err = s.db.Exec(ctx, "DELETE FROM revoked_sessions WHERE expires_at <= now()")
+			if err != nil {
+				log.Printf("Failed to remove expired session revocations: %v", err)
+			}
+			_, err = s.db.Exec(ctx, "DELETE FROM two_factor_challenges WHERE expires_at <= now()")
+			if err != nil {
+				log.Printf("Failed to remove expired two-factor challenges: %v", err)
+			}
+			_, err = s.db.Exec(ctx, "DELETE FROM oidc_login_states WHERE expires_at <= now()")
+			if err != nil {
+				log.Printf("Failed to remove expired OIDC login states: %v", err)
+			}
+			_, err = s.db.Exec(ctx, "DELETE FROM password_reset_tokens WHERE expires_at <= now()")
+			if err != nil {
+				log.Printf("Failed to remove expired password reset tokens: %v", err)
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// deleteSessions deletes the sessions matching the condition and puts them on
+// the revocation list until every signed access token issued for them has
+// expired. The condition's arguments start at $2. It returns the number of
+// deleted sessions.
+func (s *Storage) deleteSessions(ctx context.Context, q execer, condition string, args ...interface{}) (int64, error) {
+	args = append([]interface{}{time.Now().Add(s.accessTokenTTL)}, args...)
+	result, err := q.Exec(ctx, "WITH deleted AS (DELETE FROM sessions WHERE "+condition+" RETURNING public_id) INSERT INTO revoked_sessions (session_id, expires_at) SELECT public_id, $1::timestamptz FROM deleted ON CONFLICT (session_id) DO UPDATE SET expires_at = EXCLUDED.expires_at", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// verifyPassword checks the login/password pair. Hashes made with outdated
+// algorithms or parameters are replaced with fresh ones on success, which is
+// how legacy MD5 hashes are migrated, as are hashes of passwords that were
+// trimmed before hashing. Disabled users fail with
+// ErrAccountDisabled once the password is checked.
+func (s *Storage) verifyPassword(ctx context.Context, tx pgx.Tx, login, password string) (int64, error) {
+	var userID int64
+	var storedHash *string
+	var passwordTrimmed, disabled bool
+	err := tx.QueryRow(ctx, "SELECT id, password_hash, password_trimmed, disabled_at IS NOT NULL FROM users WHERE login = $1", login).Scan(&userID, &storedHash, &passwordTrimmed, &disabled)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	// Users provisioned from an identity provider have no password.
+	if storedHash == nil {
+		// Spend the same time as for an existing user so logins can't be
+		// enumerated by response time.
+		if _, errHash := s.passwords.Hash(password); errHash != nil {
+			return 0, errHash
+		}
+		return 0, ErrInvalidLoginPassword
+	}
+	passwordHash := *storedHash
+
+	match, needsRehash, err := s.passwords.Verify(password, passwordHash)
+	if err != nil {
+		return 0, err
+	}
+	// Passwords used to be trimmed before hashing, so hashes from back then
+	// also match the trimmed password, until they are replaced with a hash
+	// of the password as it was entered.
+	if !match && passwordTrimmed && strings.TrimSpace(password) != password {
+		match, _, err = s.passwords.Verify(strings.TrimSpace(password), passwordHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !match {
+		return 0, ErrInvalidLoginPassword
+	}
+
+	if needsRehash || passwordTrimmed {
+		newHash, err := s.passwords.Hash(password)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE users SET password_hash = $1, password_trimmed = FALSE WHERE id = $2 AND password_hash = $3", newHash, userID, passwordHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if disabled {
+		return 0, ErrAccountDisabled
+	}
+
+	return userID, nil
+}
+
+// issueRefreshToken adds a new refresh token to the session. Only its hash is
+// stored.
+func (s *Storage) issueRefreshToken(ctx context.Context, tx pgx.Tx, sessionID string) (string, error) {
+	refreshToken, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)", hashToken(refreshToken), sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
 func generateToken() (string, error) {
 	bytes := make([]byte, 16) // для 128-битного токена
 	if _, err := rand.Read(bytes); err != nil {
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+var ErrShareLinkNotFound = errors.New("share link not found")
+var ErrShareLinkExpired = errors.New("share link expired")
+var ErrShareLinkExhausted = errors.New("share link download limit reached")
+var ErrInvalidSharePassword = errors.New("invalid share link password")
+
+// CreateShareLink creates a public link to an asset of the user. An empty
+// password leaves the link unprotected.
+func (s *Storage) CreateShareLink(ctx context.Context, link types.ShareLink, password string) (types.ShareLink, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM assets WHERE name = $1 AND uid = $2)", link.AssetName, link.UserID).Scan(&exists)
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	if !exists {
+		return types.ShareLink{}, ErrAssetNotFound
+	}
+
+	var passwordHash *string
+	if password != "" {
+		hash, err := s.passwords.Hash(password)
+		if err != nil {
+			return types.ShareLink{}, err
+		}
+		passwordHash = &hash
+	}
+	link.HasPassword = passwordHash != nil
+
+	link.ID, err = generateToken()
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+
+	err = s.db.QueryRow(ctx, "INSERT INTO share_links (id, uid, asset_name, password_hash, expires_at, max_downloads) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at", link.ID, link.UserID, link.AssetName, passwordHash, link.ExpiresAt, link.MaxDownloads).Scan(&link.CreatedAt)
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+
+	return link, nil
+}
+
+func (s *Storage) ListShareLinks(ctx context.Context, userID int64) ([]types.ShareLink, error) {
+	rows, err := s.db.Query(ctx, "SELECT id, uid, asset_name, password_hash IS NOT NULL, expires_at, max_downloads, download_count, created_at FROM share_links WHERE uid = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []types.ShareLink
+	for rows.Next() {
+		var link types.ShareLink
+		err := rows.Scan(&link.ID, &link.UserID, &link.AssetName, &link.HasPassword, &link.ExpiresAt, &link.MaxDownloads, &link.DownloadCount, &link.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+func (s *Storage) DeleteShareLink(ctx context.Context, userID int64, linkID string) error {
+	result, err := s.db.Exec(ctx, "DELETE FROM share_links WHERE id = $1 AND uid = $2", linkID, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrShareLinkNotFound
+	}
+
+	return nil
+}
+
+// OpenSharedAsset checks the link and opens the latest version of the shared
+// asset without counting a download, see CountShareLinkDownload. Wrong
+// passwords are throttled per link and per address like failed logins. Links
+// of disabled or deleted users are reported as ErrShareLinkNotFound. The
+// caller must close the body.
+func (s *Storage) OpenSharedAsset(ctx context.Context, linkID, password, ipAddress string) (types.ShareLink, *types.AssetContent, error) {
+	link := types.ShareLink{ID: linkID}
+	var passwordHash *string
+	var expired, exhausted bool
+	err := s.db.QueryRow(ctx, "SELECT uid, asset_name, password_hash, expires_at, max_downloads, download_count, created_at, expires_at IS NOT NULL AND expires_at <= now(), max_downloads IS NOT NULL AND download_count >= max_downloads FROM share_links l WHERE id = $1 AND (EXISTS (SELECT 1 FROM users u WHERE u.id = l.uid AND u.disabled_at IS NULL) OR EXISTS (SELECT 1 FROM organizations o WHERE o.id = l.uid))", linkID).Scan(&link.UserID, &link.AssetName, &passwordHash, &link.ExpiresAt, &link.MaxDownloads, &link.DownloadCount, &link.CreatedAt, &expired, &exhausted)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.ShareLink{}, nil, ErrShareLinkNotFound
+		}
+		return types.ShareLink{}, nil, err
+	}
+	link.HasPassword = passwordHash != nil
+
+	if expired {
+		return types.ShareLink{}, nil, ErrShareLinkExpired
+	}
+
+	if passwordHash != nil {
+		attempt, err := s.reserveSharePasswordAttempt(ctx, linkID, ipAddress)
+		if err != nil {
+			return types.ShareLink{}, nil, err
+		}
+		defer attempt.release(ctx)
+
+		match, _, err := s.passwords.Verify(password, *passwordHash)
+		if err != nil {
+			return types.ShareLink{}, nil, err
+		}
+		if !match {
+			attempt.fail(ctx)
+			return types.ShareLink{}, nil, ErrInvalidSharePassword
+		}
+
+		if _, err := s.db.Exec(ctx, "DELETE FROM login_failures WHERE key = $1", shareLinkLoginKey(linkID)); err != nil {
+			return types.ShareLink{}, nil, err
+		}
+	}
+
+	if exhausted {
+		return types.ShareLink{}, nil, ErrShareLinkExhausted
+	}
+
+	content, err := s.GetAsset(ctx, link.UserID, link.AssetName, 0)
+	if err != nil {
+		return types.ShareLink{}, nil, err
+	}
+
+	return link, content, nil
+}
+
+// CountShareLinkDownload counts a download against the link's limit. It fails
+// with ErrShareLinkExhausted once the limit has been reached.
+func (s *Storage) CountShareLinkDownload(ctx context.Context, linkID string) error {
+	result, err := s.db.Exec(ctx, "UPDATE share_links SET download_count = download_count + 1 WHERE id = $1 AND (max_downloads IS NULL OR download_count < max_downloads)", linkID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrShareLinkExhausted
+	}
+
+	return nil
+}
+
+// revokeShareLinks removes the links to an asset whose last version has been
+// deleted, see revokeAssetAccess.
+func (s *Storage) revokeShareLinks(ctx context.Context, tx pgx.Tx, userID int64, assetName string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM share_links WHERE uid = $1 AND asset_name = $2 AND NOT EXISTS (SELECT 1 FROM assets WHERE uid = $1 AND name = $2)", userID, assetName)
+	return err
+}
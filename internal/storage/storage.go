@@ -2,21 +2,32 @@ package storage
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 
 	"github.com/ArturV19/file-storage/config"
+	"github.com/ArturV19/file-storage/internal/blobstore"
+	"github.com/ArturV19/file-storage/internal/password"
 )
 
 type Storage struct {
-	db *pgxpool.Pool
+	db         *pgxpool.Pool
+	blobs      blobstore.Store
+	passwords  *password.Hasher
+	versioning bool
+
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	slidingSessions bool
+	loginLimits     loginLimits
+
+	passwordResetTTL time.Duration
 }
 
-func New(cfg config.StorageConfig) (*Storage, error) {
+func New(cfg config.StorageConfig, authCfg config.AuthConfig) (*Storage, error) {
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
 		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
 
@@ -29,15 +40,68 @@ func New(cfg config.StorageConfig) (*Storage, error) {
 
 	log.Println("Successfully connected to the database")
 
-	return &Storage{db: db}, nil
+	blobs, err := newBlobStore(context.Background(), cfg, db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize blob store: %w", err)
+	}
+
+	if err := checkBlobBackend(context.Background(), db, cfg.Backend); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Printf("Using %q blob store backend\n", cfg.Backend)
+
+	passwords := password.NewHasher(password.Params{
+		Memory:  authCfg.PasswordArgon2Memory,
+		Time:    authCfg.PasswordArgon2Time,
+		Threads: authCfg.PasswordArgon2Threads,
+	})
+
+	return &Storage{
+		db:         db,
+		blobs:      blobs,
+		passwords:  passwords,
+		versioning: cfg.Versioning,
+
+		accessTokenTTL:  authCfg.AccessTokenTTL,
+		refreshTokenTTL: authCfg.RefreshTokenTTL,
+		slidingSessions: authCfg.SlidingSessions,
+		loginLimits: loginLimits{
+			backoffAfter:    authCfg.LoginBackoffAfter,
+			backoffBase:     authCfg.LoginBackoffBase,
+			lockoutAfter:    authCfg.LoginLockoutAfter,
+			ipLockoutAfter:  authCfg.LoginIPLockoutAfter,
+			lockoutDuration: authCfg.LoginLockoutDuration,
+		},
+
+		passwordResetTTL: authCfg.PasswordResetTTL,
+	}, nil
+}
+
+func newBlobStore(ctx context.Context, cfg config.StorageConfig, db *pgxpool.Pool) (blobstore.Store, error) {
+	switch cfg.Backend {
+	case "postgres":
+		return blobstore.NewPostgres(db), nil
+	case "local":
+		return blobstore.NewLocal(cfg.LocalDir)
+	case "s3":
+		return blobstore.NewS3(ctx, blobstore.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			UseSSL:    cfg.S3UseSSL,
+			PartSize:  cfg.S3PartSize,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Backend)
+	}
 }
 
 func (s *Storage) Close(_ context.Context) error {
 	s.db.Close()
 	return nil
 }
-
-func hashPassword(password string) string {
-	hash := md5.Sum([]byte(password))
-	return hex.EncodeToString(hash[:])
-}
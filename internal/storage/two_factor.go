@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/totp"
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+// A login of a user with two-factor authentication is a challenge until the
+// second factor is presented. Challenges are short-lived and allow a few
+// attempts, failed attempts also count towards the login throttling.
+const (
+	twoFactorChallengeTTL         = 5 * time.Minute
+	twoFactorChallengeMaxAttempts = 5
+	recoveryCodesCount            = 10
+)
+
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+var ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+var ErrTwoFactorNotEnrolled = errors.New("two-factor authentication enrollment is not started")
+
+// TwoFactorRequiredError is returned by NewSession for users with two-factor
+// authentication. The challenge token is exchanged for a session together
+// with the second factor, see CompleteTwoFactorLogin.
+type TwoFactorRequiredError struct {
+	ChallengeToken string
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+// CompleteTwoFactorLogin finishes a login started by NewSession with a TOTP
+// code or one of the recovery codes.
+func (s *Storage) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code string, authData types.AuthData) (types.SessionTokens, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.CompleteTwoFactorLogin tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	challengeHash := hashToken(challengeToken)
+
+	var userID int64
+	var login string
+	err = tx.QueryRow(ctx, "SELECT c.uid, u.login FROM two_factor_challenges c JOIN users u ON u.id = c.uid WHERE c.token_hash = $1 AND c.expires_at > now() AND c.attempts < $2 FOR UPDATE OF c", challengeHash, twoFactorChallengeMaxAttempts).Scan(&userID, &login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = ErrInvalidToken
+		}
+		return types.SessionTokens{}, err
+	}
+
+	attempt, err := s.reserveLoginAttempt(ctx, login, authData.IPAddress)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	defer attempt.release(ctx)
+
+	ok, err := s.verifySecondFactor(ctx, tx, userID, code)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+	if !ok {
+		if err = recordTwoFactorFailure(ctx, tx, challengeHash); err != nil {
+			return types.SessionTokens{}, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return types.SessionTokens{}, err
+		}
+		attempt.fail(ctx)
+		return types.SessionTokens{}, ErrInvalidTwoFactorCode
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM two_factor_challenges WHERE token_hash = $1", challengeHash); err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	if err = s.clearLoginFailures(ctx, tx, login); err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	tokens, err := s.startSession(ctx, tx, userID, authData)
+	if err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.SessionTokens{}, err
+	}
+
+	return tokens, nil
+}
+
+// recordTwoFactorFailure counts a wrong code for the challenge and deletes the
+// challenge once it has run out of attempts. These are separate statements on
+// purpose: a DELETE can't see the row version written by an UPDATE in its own
+// WITH clause, so combining them would never delete the challenge.
+func recordTwoFactorFailure(ctx context.Context, q queryExecer, challengeHash string) error {
+	var attempts int
+	if err := q.QueryRow(ctx, "UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE token_hash = $1 RETURNING attempts", challengeHash).Scan(&attempts); err != nil {
+		return err
+	}
+	if attempts < twoFactorChallengeMaxAttempts {
+		return nil
+	}
+
+	_, err := q.Exec(ctx, "DELETE FROM two_factor_challenges WHERE token_hash = $1", challengeHash)
+	return err
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. Two-factor
+// authentication is enabled once a code generated from the secret is
+// confirmed with ConfirmTOTP. It returns the secret and the login of the user.
+func (s *Storage) EnrollTOTP(ctx context.Context, userID int64) (string, string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	var login string
+	err = s.db.QueryRow(ctx, "UPDATE users SET totp_secret = $2 WHERE id = $1 AND NOT totp_enabled RETURNING login", userID, secret).Scan(&login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", ErrTwoFactorAlreadyEnabled
+		}
+		return "", "", err
+	}
+
+	return secret, login, nil
+}
+
+// ConfirmTOTP enables two-factor authentication if the code matches the
+// enrolled secret. It returns the recovery codes, which can't be recovered
+// later.
+func (s *Storage) ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.ConfirmTOTP tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	var secret *string
+	var enabled bool
+	err = tx.QueryRow(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&secret, &enabled)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		err = ErrTwoFactorAlreadyEnabled
+		return nil, err
+	}
+	if secret == nil {
+		err = ErrTwoFactorNotEnrolled
+		return nil, err
+	}
+
+	step, ok := totp.Validate(*secret, code, time.Now())
+	if !ok {
+		err = ErrInvalidTwoFactorCode
+		return nil, err
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE users SET totp_enabled = TRUE, totp_last_step = $2 WHERE id = $1", userID, step); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE uid = $1", userID); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := make([]string, 0, recoveryCodesCount)
+	batch := &pgx.Batch{}
+	for i := 0; i < recoveryCodesCount; i++ {
+		var recoveryCode string
+		recoveryCode, err = generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		batch.Queue("INSERT INTO recovery_codes (uid, code_hash) VALUES ($1, $2)", userID, hashToken(recoveryCode))
+	}
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. The user has to present
+// the password and a TOTP or recovery code again. Wrong passwords and codes
+// count towards the login limits like failed logins from the address.
+func (s *Storage) DisableTOTP(ctx context.Context, userID int64, password, code, ipAddress string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.DisableTOTP tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	var login string
+	var enabled bool
+	err = tx.QueryRow(ctx, "SELECT login, totp_enabled FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&login, &enabled)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		err = ErrTwoFactorNotEnabled
+		return err
+	}
+
+	attempt, err := s.reserveLoginAttempt(ctx, login, ipAddress)
+	if err != nil {
+		return err
+	}
+	defer attempt.release(ctx)
+
+	if _, err = s.verifyPassword(ctx, tx, login, password); err != nil {
+		if errors.Is(err, ErrInvalidLoginPassword) {
+			attempt.fail(ctx)
+		}
+		return err
+	}
+
+	ok, err := s.verifySecondFactor(ctx, tx, userID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		attempt.fail(ctx)
+		err = ErrInvalidTwoFactorCode
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue("UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0 WHERE id = $1", userID)
+	batch.Queue("DELETE FROM recovery_codes WHERE uid = $1", userID)
+	batch.Queue("DELETE FROM two_factor_challenges WHERE uid = $1", userID)
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// createTwoFactorChallenge starts the second step of a login. Only the hash
+// of the challenge token is stored.
+func (s *Storage) createTwoFactorChallenge(ctx context.Context, tx pgx.Tx, userID int64) (string, error) {
+	challengeToken, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO two_factor_challenges (token_hash, uid, expires_at) VALUES ($1, $2, $3)", hashToken(challengeToken), userID, time.Now().Add(twoFactorChallengeTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return challengeToken, nil
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, uses up a recovery
+// code. A TOTP code is accepted once, codes of the same or an earlier time
+// step are rejected afterwards.
+func (s *Storage) verifySecondFactor(ctx context.Context, tx pgx.Tx, userID int64, code string) (bool, error) {
+	var secret string
+	var lastStep int64
+	err := tx.QueryRow(ctx, "SELECT totp_secret, totp_last_step FROM users WHERE id = $1 AND totp_enabled FOR UPDATE", userID).Scan(&secret, &lastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		if step <= lastStep {
+			return false, nil
+		}
+		_, err = tx.Exec(ctx, "UPDATE users SET totp_last_step = $2 WHERE id = $1", userID, step)
+		return err == nil, err
+	}
+
+	result, err := tx.Exec(ctx, "UPDATE recovery_codes SET used_at = now() WHERE uid = $1 AND code_hash = $2 AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func generateRecoveryCode() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed in upper case or with
+// separators.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// challengeTable keeps the attempts of a single two-factor challenge and
+// answers the statements of recordTwoFactorFailure.
+type challengeTable struct {
+	attempts int
+	deleted  bool
+}
+
+type attemptsRow struct {
+	attempts int
+	err      error
+}
+
+func (r attemptsRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int) = r.attempts
+	return nil
+}
+
+func (c *challengeTable) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if !strings.HasPrefix(sql, "UPDATE two_factor_challenges SET attempts = attempts + 1") || c.deleted {
+		return attemptsRow{err: pgx.ErrNoRows}
+	}
+	c.attempts++
+	return attemptsRow{attempts: c.attempts}
+}
+
+func (c *challengeTable) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if strings.HasPrefix(sql, "DELETE FROM two_factor_challenges") && !c.deleted {
+		c.deleted = true
+		return pgconn.CommandTag("DELETE 1"), nil
+	}
+	return pgconn.CommandTag("DELETE 0"), nil
+}
+
+func TestRecordTwoFactorFailureDeletesExhaustedChallenge(t *testing.T) {
+	challenge := &challengeTable{}
+
+	for i := 1; i < twoFactorChallengeMaxAttempts; i++ {
+		if err := recordTwoFactorFailure(context.Background(), challenge, "hash"); err != nil {
+			t.Fatal(err)
+		}
+		if challenge.deleted {
+			t.Fatalf("challenge deleted after %d failures, want %d", i, twoFactorChallengeMaxAttempts)
+		}
+	}
+
+	if err := recordTwoFactorFailure(context.Background(), challenge, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if !challenge.deleted {
+		t.Fatalf("challenge kept after %d failures", twoFactorChallengeMaxAttempts)
+	}
+}
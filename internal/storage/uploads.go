@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ArturV19/file-storage/internal/types"
+)
+
+const UPLOAD_EXPIRATION = 24 * time.Hour
+
+var ErrUploadNotFound = errors.New("upload not found")
+var ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+
+// CreateUpload registers a resumable upload. An empty upload is finished
+// right away and kept as completed, like any other finished upload.
+func (s *Storage) CreateUpload(ctx context.Context, upload types.Upload) (types.Upload, error) {
+	err := s.checkAssetCanBeCreated(ctx, upload.UserID, upload.AssetName)
+	if err != nil {
+		return types.Upload{}, err
+	}
+
+	upload.ID, err = generateToken()
+	if err != nil {
+		return types.Upload{}, err
+	}
+	upload.Offset = 0
+	upload.ExpiresAt = time.Now().Add(UPLOAD_EXPIRATION)
+
+	err = s.db.QueryRow(ctx, "INSERT INTO uploads (id, uid, asset_name, original_name, content_type, upload_length, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at", upload.ID, upload.UserID, upload.AssetName, upload.OriginalName, upload.ContentType, upload.Length, upload.ExpiresAt).Scan(&upload.CreatedAt)
+	if err != nil {
+		return types.Upload{}, err
+	}
+
+	if upload.Length == 0 {
+		if err := s.finishUpload(ctx, upload); err != nil {
+			return types.Upload{}, err
+		}
+		upload.Completed = true
+	}
+
+	return upload, nil
+}
+
+func (s *Storage) GetUpload(ctx context.Context, userID int64, uploadID string) (types.Upload, error) {
+	var upload types.Upload
+	var originalName *string
+	err := s.db.QueryRow(ctx, "SELECT id, uid, asset_name, original_name, content_type, upload_length, upload_offset, completed_at IS NOT NULL, created_at, expires_at FROM uploads WHERE id = $1 AND uid = $2 AND expires_at > now()", uploadID, userID).Scan(&upload.ID, &upload.UserID, &upload.AssetName, &originalName, &upload.ContentType, &upload.Length, &upload.Offset, &upload.Completed, &upload.CreatedAt, &upload.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.Upload{}, ErrUploadNotFound
+		}
+		return types.Upload{}, err
+	}
+	if originalName != nil {
+		upload.OriginalName = *originalName
+	}
+
+	return upload, nil
+}
+
+// GetUploadAssetName returns the asset name of an unexpired upload, for
+// checking access to it before its namespace is known.
+func (s *Storage) GetUploadAssetName(ctx context.Context, uploadID string) (string, error) {
+	var assetName string
+	err := s.db.QueryRow(ctx, "SELECT asset_name FROM uploads WHERE id = $1 AND expires_at > now()", uploadID).Scan(&assetName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrUploadNotFound
+		}
+		return "", err
+	}
+
+	return assetName, nil
+}
+
+// WriteUploadChunk appends body to the upload at offset, which must match the
+// current upload offset. Once the last byte is received the upload is turned
+// into an asset; the completed upload is kept until it expires.
+func (s *Storage) WriteUploadChunk(ctx context.Context, userID int64, uploadID string, offset int64, body io.Reader) (types.Upload, error) {
+	upload, err := s.GetUpload(ctx, userID, uploadID)
+	if err != nil {
+		return types.Upload{}, err
+	}
+	if upload.Offset != offset {
+		return types.Upload{}, ErrUploadOffsetMismatch
+	}
+	if upload.Completed {
+		return upload, nil
+	}
+
+	blobKey, size, err := s.blobs.Put(ctx, io.LimitReader(body, upload.Length-upload.Offset))
+	if err != nil {
+		return types.Upload{}, err
+	}
+	if size == 0 {
+		s.deleteBlob(ctx, blobKey)
+		if upload.Offset == upload.Length {
+			// A previous attempt to finish the upload failed, retry it.
+			if err := s.finishUpload(ctx, upload); err != nil {
+				return types.Upload{}, err
+			}
+		}
+		return upload, nil
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.deleteBlob(ctx, blobKey)
+		return types.Upload{}, err
+	}
+	defer func() {
+		if err != nil {
+			s.deleteBlob(ctx, blobKey)
+			if errRollback := tx.Rollback(ctx); errRollback != nil && errRollback != pgx.ErrTxClosed {
+				log.Printf("storage.WriteUploadChunk tx.Rollback error: %v", errRollback)
+			}
+		}
+	}()
+
+	upload.ExpiresAt = time.Now().Add(UPLOAD_EXPIRATION)
+	result, err := tx.Exec(ctx, "UPDATE uploads SET upload_offset = upload_offset + $1, expires_at = $2 WHERE id = $3 AND upload_offset = $4", size, upload.ExpiresAt, upload.ID, offset)
+	if err != nil {
+		return types.Upload{}, err
+	}
+	if result.RowsAffected() == 0 {
+		err = ErrUploadOffsetMismatch
+		return types.Upload{}, err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO upload_chunks (upload_id, chunk_offset, size, blob_key) VALUES ($1, $2, $3, $4)", upload.ID, offset, size, blobKey)
+	if err != nil {
+		return types.Upload{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return types.Upload{}, err
+	}
+
+	upload.Offset += size
+	if upload.Offset == upload.Length {
+		if err := s.finishUpload(ctx, upload); err != nil {
+			return types.Upload{}, err
+		}
+		upload.Completed = true
+	}
+
+	return upload, nil
+}
+
+// DeleteUpload terminates an unfinished upload and removes received chunks.
+func (s *Storage) DeleteUpload(ctx context.Context, userID int64, uploadID string) error {
+	deleted, blobKeys, err := s.deleteUploads(ctx, "id = $1 AND uid = $2", uploadID, userID)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrUploadNotFound
+	}
+
+	for _, blobKey := range blobKeys {
+		s.deleteBlob(ctx, blobKey)
+	}
+
+	return nil
+}
+
+func (s *Storage) RemoveExpiredUploads(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, blobKeys, err := s.deleteUploads(ctx, "expires_at <= now()")
+			if err != nil {
+				log.Printf("Failed to remove expired uploads: %v", err)
+				continue
+			}
+			for _, blobKey := range blobKeys {
+				s.deleteBlob(ctx, blobKey)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// finishUpload stores the received chunks as a single asset, drops the chunks
+// and marks the upload completed. If the name has been taken in the meantime
+// the upload is removed, since it can't be resumed anyway.
+func (s *Storage) finishUpload(ctx context.Context, upload types.Upload) error {
+	blobKeys, err := s.uploadChunkKeys(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	body := newBlobChain(ctx, s.blobs, blobKeys)
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Printf("storage.finishUpload body.Close error: %v", err)
+		}
+	}()
+
+	_, errUpload := s.UploadAsset(ctx, types.UploadAssetData{
+		UserID:       upload.UserID,
+		AssetName:    upload.AssetName,
+		OriginalName: upload.OriginalName,
+		ContentType:  upload.ContentType,
+		Body:         body,
+	})
+	if errors.Is(errUpload, ErrAssetAlreadyExists) {
+		if err := s.DeleteUpload(ctx, upload.UserID, upload.ID); err != nil {
+			return err
+		}
+		return errUpload
+	}
+	if errUpload != nil {
+		return errUpload
+	}
+
+	return s.completeUpload(ctx, upload.ID)
+}
+
+// completeUpload marks the upload completed and removes its chunks.
+func (s *Storage) completeUpload(ctx context.Context, uploadID string) error {
+	rows, err := s.db.Query(ctx, "WITH completed AS (UPDATE uploads SET completed_at = now() WHERE id = $1), deleted AS (DELETE FROM upload_chunks WHERE upload_id = $1 RETURNING blob_key) SELECT blob_key FROM deleted", uploadID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var blobKeys []string
+	for rows.Next() {
+		var blobKey string
+		if err := rows.Scan(&blobKey); err != nil {
+			return err
+		}
+		blobKeys = append(blobKeys, blobKey)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, blobKey := range blobKeys {
+		s.deleteBlob(ctx, blobKey)
+	}
+
+	return nil
+}
+
+func (s *Storage) uploadChunkKeys(ctx context.Context, uploadID string) ([]string, error) {
+	rows, err := s.db.Query(ctx, "SELECT blob_key FROM upload_chunks WHERE upload_id = $1 ORDER BY chunk_offset", uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blobKeys []string
+	for rows.Next() {
+		var blobKey string
+		if err := rows.Scan(&blobKey); err != nil {
+			return nil, err
+		}
+		blobKeys = append(blobKeys, blobKey)
+	}
+
+	return blobKeys, rows.Err()
+}
+
+// deleteUploads removes the uploads matching the condition and returns the
+// number of removed uploads together with the blob keys of their chunks.
+func (s *Storage) deleteUploads(ctx context.Context, condition string, args ...interface{}) (int, []string, error) {
+	return s.deleteStagedUploads(ctx, "uploads", "upload_chunks", condition, args...)
+}
+
+// deleteStagedUploads removes rows matching the condition from uploadsTable
+// and returns their number together with the blob keys of the rows in
+// partsTable referring to them. The part rows go away through ON DELETE
+// CASCADE, but the SELECT still sees them since the statement works on a
+// single snapshot.
+func (s *Storage) deleteStagedUploads(ctx context.Context, uploadsTable, partsTable, condition string, args ...interface{}) (int, []string, error) {
+	rows, err := s.db.Query(ctx, "WITH deleted AS (DELETE FROM "+uploadsTable+" WHERE "+condition+" RETURNING id) SELECT d.id, p.blob_key FROM deleted d LEFT JOIN "+partsTable+" p ON p.upload_id = d.id", args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	uploadIDs := make(map[string]struct{})
+	var blobKeys []string
+	for rows.Next() {
+		var uploadID string
+		var blobKey *string
+		if err := rows.Scan(&uploadID, &blobKey); err != nil {
+			return 0, nil, err
+		}
+		uploadIDs[uploadID] = struct{}{}
+		if blobKey != nil {
+			blobKeys = append(blobKeys, *blobKey)
+		}
+	}
+
+	return len(uploadIDs), blobKeys, rows.Err()
+}
@@ -28,7 +28,10 @@ func (s *Storage) CreateUser(ctx context.Context, login, password string) (int64
 		}
 	}()
 
-	passwordHash := hashPassword(password)
+	passwordHash, err := s.passwords.Hash(password)
+	if err != nil {
+		return -1, err
+	}
 
 	var newUserID int64
 	err = tx.QueryRow(ctx, "INSERT INTO users (login, password_hash) VALUES ($1, $2) RETURNING id", login, passwordHash).Scan(&newUserID)
@@ -41,3 +44,34 @@ func (s *Storage) CreateUser(ctx context.Context, login, password string) (int64
 
 	return newUserID, nil
 }
+
+// GetUserLogin returns the login of the user, for checking a new password
+// against it.
+func (s *Storage) GetUserLogin(ctx context.Context, userID int64) (string, error) {
+	var login string
+	err := s.db.QueryRow(ctx, "SELECT login FROM users WHERE id = $1", userID).Scan(&login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+
+	return login, nil
+}
+
+// CheckUserActive fails with ErrUserNotFound if the user has been deleted or
+// disabled, for credentials that outlive the check at login such as presigned
+// URLs.
+func (s *Storage) CheckUserActive(ctx context.Context, userID int64) error {
+	var active bool
+	err := s.db.QueryRow(ctx, "SELECT TRUE FROM users WHERE id = $1 AND disabled_at IS NULL", userID).Scan(&active)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSigner(t *testing.T, activeKeyID string, keys map[string][]byte) *Signer {
+	t.Helper()
+
+	signer, err := NewSigner(activeKeyID, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func testClaims(expiresIn time.Duration) Claims {
+	now := time.Now().Truncate(time.Second)
+	return Claims{
+		UserID:    42,
+		SessionID: "session",
+		Scopes:    []string{"assets:read", "assets:write"},
+		IssuedAt:  now,
+		ExpiresAt: now.Add(expiresIn),
+	}
+}
+
+// resign replaces the header and payload of the token and signs them again
+// with the key.
+func resign(t *testing.T, key []byte, h header, p interface{}) string {
+	t.Helper()
+
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadJSON, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(key, signingInput))
+}
+
+func TestRoundTrip(t *testing.T) {
+	signer := testSigner(t, "k1", map[string][]byte{"k1": []byte("secret")})
+	claims := testClaims(time.Hour)
+
+	token, err := signer.Issue(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !LooksLikeToken(token) {
+		t.Fatalf("%q doesn't look like a token", token)
+	}
+
+	got, err := signer.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IssuedAt.Equal(claims.IssuedAt) || !got.ExpiresAt.Equal(claims.ExpiresAt) {
+		t.Fatalf("times = %v %v, want %v %v", got.IssuedAt, got.ExpiresAt, claims.IssuedAt, claims.ExpiresAt)
+	}
+	got.IssuedAt, got.ExpiresAt = claims.IssuedAt, claims.ExpiresAt
+	if !reflect.DeepEqual(got, claims) {
+		t.Fatalf("claims = %+v, want %+v", got, claims)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	signer := testSigner(t, "k1", map[string][]byte{"k1": []byte("secret")})
+
+	token, err := signer.Issue(testClaims(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Verify(token); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("err = %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestTamperedPayload(t *testing.T) {
+	signer := testSigner(t, "k1", map[string][]byte{"k1": []byte("secret")})
+
+	token, err := signer.Issue(testClaims(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	payloadJSON, err := json.Marshal(payload{Sub: "1", Iat: time.Now().Unix(), Exp: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payloadJSON) + "." + parts[2]
+
+	if _, err := signer.Verify(tampered); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestUnknownKeyID(t *testing.T) {
+	issuer := testSigner(t, "k2", map[string][]byte{"k2": []byte("secret")})
+	verifier := testSigner(t, "k1", map[string][]byte{"k1": []byte("secret")})
+
+	token, err := issuer.Issue(testClaims(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	before := testSigner(t, "k1", map[string][]byte{"k1": []byte("old secret")})
+	after := testSigner(t, "k2", map[string][]byte{"k1": []byte("old secret"), "k2": []byte("new secret")})
+
+	oldToken, err := before.Issue(testClaims(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := after.Issue(testClaims(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The retired key keeps verifying the tokens it signed.
+	if _, err := after.Verify(oldToken); err != nil {
+		t.Fatalf("token of the retired key: %v", err)
+	}
+	if _, err := after.Verify(newToken); err != nil {
+		t.Fatalf("token of the active key: %v", err)
+	}
+	// New tokens are signed with the new key only.
+	if _, err := before.Verify(newToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestRejectsOtherAlgorithms(t *testing.T) {
+	key := []byte("secret")
+	signer := testSigner(t, "k1", map[string][]byte{"k1": key})
+	p := payload{Sub: "42", Iat: time.Now().Unix(), Exp: time.Now().Add(time.Hour).Unix()}
+
+	for _, alg := range []string{"none", "HS384", "RS256", "hs256"} {
+		token := resign(t, key, header{Alg: alg, Typ: "JWT", Kid: "k1"}, p)
+		if _, err := signer.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("alg %q: err = %v, want %v", alg, err, ErrInvalidToken)
+		}
+	}
+
+	// The same token with HS256 is accepted, so only the algorithm differs.
+	if _, err := signer.Verify(resign(t, key, header{Alg: "HS256", Typ: "JWT", Kid: "k1"}, p)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	signer := testSigner(t, "k1", map[string][]byte{"k1": []byte("secret")})
+
+	for _, token := range []string{"", "a.b", "a.b.c", "a.b.c.d"} {
+		if _, err := signer.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%q: err = %v, want %v", token, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestNewSignerRequiresActiveKey(t *testing.T) {
+	if _, err := NewSigner("k2", map[string][]byte{"k1": []byte("secret")}); err == nil {
+		t.Fatal("signer without its active key created")
+	}
+}
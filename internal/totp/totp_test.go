@@ -0,0 +1,84 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the test vectors in RFC 6238 Appendix B,
+// "12345678901234567890", base32 encoded.
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// The RFC lists 8 digit codes; the 6 digit codes are their last 6 digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestGenerateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		if code := generate([]byte("12345678901234567890"), v.unix/period); code != v.code {
+			t.Errorf("code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		step, ok := Validate(rfcSecret, v.code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("code at %d rejected", v.unix)
+			continue
+		}
+		if step != v.unix/period {
+			t.Errorf("step at %d = %d, want %d", v.unix, step, v.unix/period)
+		}
+	}
+}
+
+func TestValidateDrift(t *testing.T) {
+	key, err := encoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / period
+
+	for drift := int64(-2); drift <= 2; drift++ {
+		step, ok := Validate(rfcSecret, generate(key, current+drift), now)
+		accepted := drift >= -1 && drift <= 1
+		if ok != accepted {
+			t.Errorf("drift of %d steps: accepted = %t, want %t", drift, ok, accepted)
+		}
+		if ok && step != current+drift {
+			t.Errorf("drift of %d steps: step = %d, want %d", drift, step, current+drift)
+		}
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870820", "94287082", "28708a", " 87082", "287 82"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "287082", now); ok {
+		t.Error("code for a malformed secret accepted")
+	}
+}
+
+func TestValidateLowercaseSecret(t *testing.T) {
+	if _, ok := Validate(strings.ToLower(rfcSecret), "287082", time.Unix(59, 0)); !ok {
+		t.Error("code for a lowercase secret rejected")
+	}
+}
@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+const (
+	ScopeAssetsRead   = "assets:read"
+	ScopeAssetsWrite  = "assets:write"
+	ScopeAssetsDelete = "assets:delete"
+)
+
+// APIKey is a long-lived credential for automation. The key itself is only
+// known when it is created; it is stored hashed.
+type APIKey struct {
+	ID         string
+	UserID     int64
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
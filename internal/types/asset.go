@@ -4,7 +4,18 @@ import "time"
 
 type Asset struct {
 	Name         string    `json:"name"`
+	Version      int       `json:"version"`
 	OriginalName string    `json:"original_name"`
 	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
+	// Owner is the login of the user who shared the asset. It is empty for
+	// the user's own assets.
+	Owner string `json:"owner,omitempty"`
 }
+
+// AssetPrecondition is checked against the asset version a write targets,
+// or nil if there is none, while the asset is locked. A non-nil error aborts
+// the write and is returned to the caller.
+type AssetPrecondition func(current *Asset) error
@@ -0,0 +1,16 @@
+package types
+
+import (
+	"io"
+	"time"
+)
+
+type AssetContent struct {
+	Body         io.ReadSeekCloser
+	Version      int
+	OriginalName string
+	ContentType  string
+	Size         int64
+	ETag         string
+	CreatedAt    time.Time
+}
@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+const (
+	PermissionRead      = "read"
+	PermissionReadWrite = "read-write"
+)
+
+// AssetGrant gives another user access to an asset of the owner, or to every
+// asset whose name starts with AssetName if IsPrefix is set.
+type AssetGrant struct {
+	ID           int64
+	OwnerID      int64
+	GranteeLogin string
+	AssetName    string
+	IsPrefix     bool
+	Permission   string
+	CreatedAt    time.Time
+}
@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+type AssetVersion struct {
+	Version      int       `json:"version"`
+	OriginalName string    `json:"original_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	IsLatest     bool      `json:"is_latest"`
+}
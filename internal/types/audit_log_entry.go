@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+const (
+	AdminActionListUsers          = "list_users"
+	AdminActionViewUser           = "view_user"
+	AdminActionDisableUser        = "disable_user"
+	AdminActionEnableUser         = "enable_user"
+	AdminActionGrantAdmin         = "grant_admin"
+	AdminActionRevokeAdmin        = "revoke_admin"
+	AdminActionRevokeSessions     = "revoke_sessions"
+	AdminActionListAssets         = "list_assets"
+	AdminActionDeleteAsset        = "delete_asset"
+	AdminActionListLoginLockouts  = "list_login_lockouts"
+	AdminActionClearLoginFailures = "clear_login_failures"
+	AdminActionBootstrapAdmin     = "bootstrap_admin"
+)
+
+// AuditLogEntry records an action taken through the admin API. Target is
+// the login the action was taken on, if any. AdminLogin is empty for the
+// admin role given from the configuration.
+type AuditLogEntry struct {
+	ID         int64
+	AdminLogin string
+	Action     string
+	Target     string
+	Details    map[string]interface{}
+	CreatedAt  time.Time
+}
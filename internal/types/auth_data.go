@@ -4,4 +4,5 @@ type AuthData struct {
 	Login     string
 	Password  string
 	IPAddress string
+	UserAgent string
 }
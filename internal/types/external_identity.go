@@ -0,0 +1,10 @@
+package types
+
+// ExternalIdentity is a user authenticated by an identity provider.
+type ExternalIdentity struct {
+	Issuer  string
+	Subject string
+	// Logins are the logins the user may get when it is provisioned, in
+	// order of preference. The first one that isn't taken is given.
+	Logins []string
+}
@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+// LoginLockout is a lockout of an account ("account"), an address ("ip") or
+// a password protected share link ("share_link") after too many failed
+// attempts.
+type LoginLockout struct {
+	ID          int64
+	Kind        string
+	Subject     string
+	Failures    int
+	LockedUntil time.Time
+	CreatedAt   time.Time
+}
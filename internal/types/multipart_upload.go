@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+type MultipartUpload struct {
+	ID           string
+	UserID       int64
+	AssetName    string
+	OriginalName string
+	ContentType  string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type UploadPart struct {
+	PartNumber int       `json:"part_number"`
+	ETag       string    `json:"etag"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package types
+
+import "time"
+
+// OIDCLoginState is kept between the redirect to the identity provider and
+// the callback.
+type OIDCLoginState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
@@ -0,0 +1,24 @@
+package types
+
+import "time"
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Organization is a shared asset namespace. Role is the role of the user the
+// organization was looked up for.
+type Organization struct {
+	ID        int64
+	Name      string
+	Role      string
+	CreatedAt time.Time
+}
+
+type OrganizationMember struct {
+	Login     string
+	Role      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+// Session is a login of a user. ID is the public ID of the session, not its
+// token.
+type Session struct {
+	ID        string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Current is set for the session the listing was requested with.
+	Current bool
+}
@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+// SessionTokens are issued on login and on every refresh.
+type SessionTokens struct {
+	UserID int64
+	// SessionID is the public ID of the session.
+	SessionID    string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+type ShareLink struct {
+	ID            string
+	UserID        int64
+	AssetName     string
+	HasPassword   bool
+	ExpiresAt     *time.Time
+	MaxDownloads  *int
+	DownloadCount int
+	CreatedAt     time.Time
+}
@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+type Upload struct {
+	ID           string
+	UserID       int64
+	AssetName    string
+	OriginalName string
+	ContentType  string
+	Length       int64
+	Offset       int64
+	// Completed is set once the asset has been created from the upload.
+	Completed bool
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
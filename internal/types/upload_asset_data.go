@@ -8,4 +8,11 @@ type UploadAssetData struct {
 	OriginalName string
 	ContentType  string
 	Body         io.Reader
+	// Overwrite replaces an existing asset instead of failing. With
+	// versioning enabled every upload adds a version regardless.
+	Overwrite    bool
+	Precondition AssetPrecondition
+	// SHA256 is the hex digest of Body announced by the client, if any. Body
+	// is not written when content with this digest is already stored.
+	SHA256 string
 }
@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+// UserAccount is a user as seen by administrators. Assets, versions and
+// storage usage count every stored version in the user's own namespace.
+type UserAccount struct {
+	ID               int64
+	Login            string
+	Admin            bool
+	DisabledAt       *time.Time
+	TwoFactorEnabled bool
+	// External is set for users provisioned from an identity provider, who
+	// have no password.
+	External       bool
+	CreatedAt      time.Time
+	Assets         int64
+	AssetVersions  int64
+	StorageBytes   int64
+	ActiveSessions int64
+}
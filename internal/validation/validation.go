@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ArturV19/file-storage/config"
+)
+
+const (
+	FieldLogin    = "login"
+	FieldPassword = "password"
+)
+
+// Codes of validation errors, for clients to tell them apart.
+const (
+	CodeRequired      = "required"
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeInvalidFormat = "invalid_format"
+	CodeReserved      = "reserved"
+	CodeTooSimple     = "too_simple"
+	CodeCommon        = "common"
+	CodeContainsLogin = "contains_login"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+// FieldError describes why the value of a request field is rejected.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Policy checks logins and passwords against the configured rules.
+type Policy struct {
+	cfg             config.AccountPolicyConfig
+	loginPattern    *regexp.Regexp
+	reservedLogins  map[string]struct{}
+	commonPasswords map[string]struct{}
+}
+
+func NewPolicy(cfg config.AccountPolicyConfig) (*Policy, error) {
+	loginPattern, err := regexp.Compile(cfg.LoginPattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile login pattern: %w", err)
+	}
+
+	reservedLogins := make(map[string]struct{}, len(cfg.LoginReserved))
+	for _, login := range cfg.LoginReserved {
+		reservedLogins[strings.ToLower(login)] = struct{}{}
+	}
+
+	commonPasswords := make(map[string]struct{})
+	if cfg.PasswordRejectCommon {
+		scanner := bufio.NewScanner(strings.NewReader(commonPasswordsList))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				commonPasswords[strings.ToLower(line)] = struct{}{}
+			}
+		}
+	}
+
+	return &Policy{
+		cfg:             cfg,
+		loginPattern:    loginPattern,
+		reservedLogins:  reservedLogins,
+		commonPasswords: commonPasswords,
+	}, nil
+}
+
+// ValidateLogin returns the rules the login of a new user breaks.
+func (p *Policy) ValidateLogin(login string) []FieldError {
+	if login == "" {
+		return []FieldError{{Field: FieldLogin, Code: CodeRequired, Message: "Login is required"}}
+	}
+
+	var errs []FieldError
+	length := utf8.RuneCountInString(login)
+	if length < p.cfg.LoginMinLength {
+		errs = append(errs, FieldError{Field: FieldLogin, Code: CodeTooShort, Message: fmt.Sprintf("Login must be at least %d characters long", p.cfg.LoginMinLength)})
+	}
+	if length > p.cfg.LoginMaxLength {
+		errs = append(errs, FieldError{Field: FieldLogin, Code: CodeTooLong, Message: fmt.Sprintf("Login must be at most %d characters long", p.cfg.LoginMaxLength)})
+	}
+	if !p.loginPattern.MatchString(login) {
+		errs = append(errs, FieldError{Field: FieldLogin, Code: CodeInvalidFormat, Message: "Login contains characters that are not allowed"})
+	}
+	if _, ok := p.reservedLogins[strings.ToLower(login)]; ok {
+		errs = append(errs, FieldError{Field: FieldLogin, Code: CodeReserved, Message: "Login is reserved"})
+	}
+
+	return errs
+}
+
+// ValidatePassword returns the rules a new password of the user with the
+// login breaks. Passwords are taken as they are, whitespace included.
+func (p *Policy) ValidatePassword(login, password string) []FieldError {
+	if password == "" {
+		return []FieldError{{Field: FieldPassword, Code: CodeRequired, Message: "Password is required"}}
+	}
+
+	var errs []FieldError
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.PasswordMinLength {
+		errs = append(errs, FieldError{Field: FieldPassword, Code: CodeTooShort, Message: fmt.Sprintf("Password must be at least %d characters long", p.cfg.PasswordMinLength)})
+	}
+	if length > p.cfg.PasswordMaxLength {
+		errs = append(errs, FieldError{Field: FieldPassword, Code: CodeTooLong, Message: fmt.Sprintf("Password must be at most %d characters long", p.cfg.PasswordMaxLength)})
+	}
+	if characterKinds(password) < p.cfg.PasswordMinCharacterKinds {
+		errs = append(errs, FieldError{Field: FieldPassword, Code: CodeTooSimple, Message: fmt.Sprintf("Password must mix at least %d of lower case letters, upper case letters, digits and other characters", p.cfg.PasswordMinCharacterKinds)})
+	}
+	if _, ok := p.commonPasswords[strings.ToLower(password)]; ok {
+		errs = append(errs, FieldError{Field: FieldPassword, Code: CodeCommon, Message: "Password is too common"})
+	}
+	if login != "" && strings.Contains(strings.ToLower(password), strings.ToLower(login)) {
+		errs = append(errs, FieldError{Field: FieldPassword, Code: CodeContainsLogin, Message: "Password must not contain the login"})
+	}
+
+	return errs
+}
+
+// characterKinds counts which of lower case letters, upper case letters,
+// digits and other characters the password contains.
+func characterKinds(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	kinds := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			kinds++
+		}
+	}
+	return kinds
+}
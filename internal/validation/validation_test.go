@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/ArturV19/file-storage/config"
+)
+
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+
+	policy, err := NewPolicy(config.AccountPolicyConfig{
+		LoginMinLength:            3,
+		LoginMaxLength:            32,
+		LoginPattern:              `^[A-Za-z0-9][A-Za-z0-9._-]*$`,
+		LoginReserved:             []string{"admin"},
+		PasswordMinLength:         8,
+		PasswordMaxLength:         256,
+		PasswordMinCharacterKinds: 2,
+		PasswordRejectCommon:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func hasCode(errs []FieldError, code string) bool {
+	for _, err := range errs {
+		if err.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidatePasswordRejectsCommonPasswords(t *testing.T) {
+	policy := testPolicy(t)
+
+	// From our own entries and from the bundled zxcvbn list.
+	for _, password := range []string{"password1", "Password1", "trustno1", "mustang1"} {
+		if errs := policy.ValidatePassword("alice", password); !hasCode(errs, CodeCommon) {
+			t.Errorf("%q not rejected as common: %v", password, errs)
+		}
+	}
+
+	if errs := policy.ValidatePassword("alice", "correct-horse-7"); len(errs) > 0 {
+		t.Errorf("uncommon password rejected: %v", errs)
+	}
+}
+
+func TestValidatePasswordRejectsLogin(t *testing.T) {
+	policy := testPolicy(t)
+
+	if errs := policy.ValidatePassword("alice", "Secret-Alice-7"); !hasCode(errs, CodeContainsLogin) {
+		t.Errorf("password containing the login not rejected: %v", errs)
+	}
+}
+
+func TestValidateLogin(t *testing.T) {
+	policy := testPolicy(t)
+
+	for login, code := range map[string]string{
+		"":          CodeRequired,
+		"al":        CodeTooShort,
+		"bob smith": CodeInvalidFormat,
+		"Admin":     CodeReserved,
+	} {
+		if errs := policy.ValidateLogin(login); !hasCode(errs, code) {
+			t.Errorf("login %q: got %v, want %s", login, errs, code)
+		}
+	}
+
+	if errs := policy.ValidateLogin("alice"); len(errs) > 0 {
+		t.Errorf("valid login rejected: %v", errs)
+	}
+}
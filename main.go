@@ -11,6 +11,7 @@ import (
 
 	"github.com/ArturV19/file-storage/config"
 	"github.com/ArturV19/file-storage/internal/api"
+	"github.com/ArturV19/file-storage/internal/notify"
 	"github.com/ArturV19/file-storage/internal/storage"
 	"github.com/ArturV19/file-storage/internal/utils"
 )
@@ -29,19 +30,35 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.SetPrefix("[" + strings.ToUpper(cfg.LogLvl) + "] ")
 
-	newStorage, err := storage.New(cfg.Storage)
+	newStorage, err := storage.New(cfg.Storage, cfg.Auth)
 	if err != nil {
 		log.Fatalf("Error initializing storage: %v\n", err)
 	} else {
 		log.Println("AssetStorage initialized")
 	}
 
-	// Start the expired session removal routine
+	if len(cfg.Auth.AdminLogins) > 0 {
+		if err := newStorage.BootstrapAdminRole(context.Background(), cfg.Auth.AdminLogins); err != nil {
+			log.Fatalf("Error granting the admin role: %v\n", err)
+		}
+	}
+
+	// Start the expired session, upload, unreferenced blob and stale login
+	// failure removal routines
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go newStorage.RemoveExpiredSessions(ctx)
+	go newStorage.RemoveExpiredUploads(ctx)
+	go newStorage.RemoveExpiredMultipartUploads(ctx)
+	go newStorage.RemoveUnreferencedBlobs(ctx)
+	go newStorage.RemoveStaleLoginFailures(ctx)
+
+	notifier, err := notify.New(cfg.Notifier)
+	if err != nil {
+		log.Fatalf("Error initializing notifier: %v\n", err)
+	}
 
-	apiServer := api.New(cfg.HTTPConfig, newStorage, newStorage)
+	apiServer, err := api.New(cfg.HTTPConfig, cfg.Auth, newStorage, newStorage, notifier)
 	if err != nil {
 		log.Fatalf("Error initializing API server: %v\n", err)
 	}
@@ -0,0 +1,8 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS data BYTEA;
+
+UPDATE assets SET data = lo_get(data_oid);
+SELECT lo_unlink(data_oid) FROM assets;
+
+ALTER TABLE assets ALTER COLUMN data SET NOT NULL;
+ALTER TABLE assets DROP COLUMN IF EXISTS size;
+ALTER TABLE assets DROP COLUMN IF EXISTS data_oid;
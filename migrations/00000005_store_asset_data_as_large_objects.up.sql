@@ -0,0 +1,7 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS data_oid OID;
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0;
+
+UPDATE assets SET data_oid = lo_from_bytea(0, data), size = octet_length(data);
+
+ALTER TABLE assets ALTER COLUMN data_oid SET NOT NULL;
+ALTER TABLE assets DROP COLUMN IF EXISTS data;
@@ -0,0 +1,2 @@
+ALTER TABLE assets ALTER COLUMN blob_key TYPE OID USING blob_key::oid;
+ALTER TABLE assets RENAME COLUMN blob_key TO data_oid;
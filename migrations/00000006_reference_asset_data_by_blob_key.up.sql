@@ -0,0 +1,2 @@
+ALTER TABLE assets RENAME COLUMN data_oid TO blob_key;
+ALTER TABLE assets ALTER COLUMN blob_key TYPE TEXT USING blob_key::text;
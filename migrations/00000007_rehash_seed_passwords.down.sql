@@ -0,0 +1,4 @@
+UPDATE users
+SET password_hash = encode(digest('secret', 'md5'), 'hex')
+WHERE login = 'alice'
+  AND CASE WHEN password_hash LIKE '$2a$%' THEN password_hash = crypt('secret', password_hash) ELSE false END;
@@ -0,0 +1,4 @@
+-- Hashes are upgraded to argon2id on the next successful login.
+UPDATE users
+SET password_hash = crypt('secret', gen_salt('bf', 10))
+WHERE login = 'alice' AND password_hash = encode(digest('secret', 'md5'), 'hex');
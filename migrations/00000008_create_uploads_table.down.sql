@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS upload_chunks;
+DROP INDEX IF EXISTS idx_uploads_expires_at;
+DROP INDEX IF EXISTS idx_uploads_uid;
+DROP TABLE IF EXISTS uploads;
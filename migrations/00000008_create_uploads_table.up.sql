@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS uploads (
+    id TEXT PRIMARY KEY,
+    uid BIGINT NOT NULL,
+    asset_name TEXT NOT NULL,
+    original_name TEXT,
+    content_type TEXT NOT NULL DEFAULT 'application/octet-stream',
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_uid ON uploads (uid);
+CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads (expires_at);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    upload_id TEXT NOT NULL REFERENCES uploads (id) ON DELETE CASCADE,
+    chunk_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    blob_key TEXT NOT NULL,
+    PRIMARY KEY (upload_id, chunk_offset)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS multipart_upload_parts;
+DROP INDEX IF EXISTS idx_multipart_uploads_expires_at;
+DROP INDEX IF EXISTS idx_multipart_uploads_uid;
+DROP TABLE IF EXISTS multipart_uploads;
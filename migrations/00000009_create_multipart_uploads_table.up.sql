@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS multipart_uploads (
+    id TEXT PRIMARY KEY,
+    uid BIGINT NOT NULL,
+    asset_name TEXT NOT NULL,
+    original_name TEXT,
+    content_type TEXT NOT NULL DEFAULT 'application/octet-stream',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_multipart_uploads_uid ON multipart_uploads (uid);
+CREATE INDEX IF NOT EXISTS idx_multipart_uploads_expires_at ON multipart_uploads (expires_at);
+
+CREATE TABLE IF NOT EXISTS multipart_upload_parts (
+    upload_id TEXT NOT NULL REFERENCES multipart_uploads (id) ON DELETE CASCADE,
+    part_number INT NOT NULL,
+    etag TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    blob_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (upload_id, part_number)
+);
@@ -0,0 +1,10 @@
+-- Older versions are dropped; their blobs are left in the blob store.
+DELETE FROM assets a
+WHERE EXISTS (
+    SELECT 1 FROM assets newer
+    WHERE newer.name = a.name AND newer.uid = a.uid AND newer.version > a.version
+);
+
+ALTER TABLE assets DROP CONSTRAINT IF EXISTS assets_pkey;
+ALTER TABLE assets ADD PRIMARY KEY (name, uid);
+ALTER TABLE assets DROP COLUMN IF EXISTS version;
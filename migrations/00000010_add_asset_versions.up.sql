@@ -0,0 +1,4 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE assets DROP CONSTRAINT IF EXISTS assets_pkey;
+ALTER TABLE assets ADD PRIMARY KEY (name, uid, version);
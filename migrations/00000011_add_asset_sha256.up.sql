@@ -0,0 +1,2 @@
+-- Assets uploaded before this migration have no digest and therefore no ETag.
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS sha256 TEXT;
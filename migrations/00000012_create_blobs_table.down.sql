@@ -0,0 +1,6 @@
+-- Assets keep pointing at shared blobs; deleting one of them afterwards
+-- removes the content of the others.
+ALTER TABLE assets DROP CONSTRAINT IF EXISTS assets_blob_key_fkey;
+DROP INDEX IF EXISTS idx_assets_blob_key;
+DROP INDEX IF EXISTS idx_blobs_unreferenced;
+DROP TABLE IF EXISTS blobs;
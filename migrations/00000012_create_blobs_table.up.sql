@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS blobs (
+    blob_key TEXT PRIMARY KEY,
+    sha256 TEXT UNIQUE,
+    size BIGINT NOT NULL,
+    ref_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_blobs_unreferenced ON blobs (blob_key) WHERE ref_count <= 0;
+
+INSERT INTO blobs (blob_key, size)
+SELECT blob_key, MAX(size) FROM assets GROUP BY blob_key;
+
+-- Point assets with the same content at a single blob. The blobs left without
+-- references are removed by the garbage collector.
+UPDATE assets a
+SET blob_key = canonical.blob_key
+FROM (
+    SELECT DISTINCT ON (sha256) sha256, blob_key
+    FROM assets
+    WHERE sha256 IS NOT NULL
+    ORDER BY sha256, created_at
+) canonical
+WHERE a.sha256 = canonical.sha256 AND a.blob_key <> canonical.blob_key;
+
+UPDATE blobs b
+SET sha256 = a.sha256
+FROM (SELECT DISTINCT blob_key, sha256 FROM assets WHERE sha256 IS NOT NULL) a
+WHERE a.blob_key = b.blob_key;
+
+UPDATE blobs b
+SET ref_count = refs.ref_count
+FROM (SELECT blob_key, COUNT(*) AS ref_count FROM assets GROUP BY blob_key) refs
+WHERE refs.blob_key = b.blob_key;
+
+CREATE INDEX IF NOT EXISTS idx_assets_blob_key ON assets (blob_key);
+ALTER TABLE assets ADD CONSTRAINT assets_blob_key_fkey FOREIGN KEY (blob_key) REFERENCES blobs (blob_key);
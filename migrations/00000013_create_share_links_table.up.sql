@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS share_links (
+    id TEXT PRIMARY KEY,
+    uid BIGINT NOT NULL,
+    asset_name TEXT NOT NULL,
+    password_hash TEXT,
+    expires_at TIMESTAMPTZ,
+    max_downloads INT,
+    download_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_uid ON share_links (uid);
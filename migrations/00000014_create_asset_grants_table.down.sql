@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_asset_grants_grantee_uid;
+DROP TABLE IF EXISTS asset_grants;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS asset_grants (
+    id BIGSERIAL PRIMARY KEY,
+    owner_uid BIGINT NOT NULL,
+    grantee_uid BIGINT NOT NULL,
+    asset_name TEXT NOT NULL,
+    is_prefix BOOLEAN NOT NULL DEFAULT FALSE,
+    permission TEXT NOT NULL CHECK (permission IN ('read', 'read-write')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (owner_uid, grantee_uid, asset_name, is_prefix)
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_grants_grantee_uid ON asset_grants (grantee_uid, owner_uid);
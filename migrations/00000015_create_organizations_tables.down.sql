@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_organization_members_uid;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,17 @@
+-- Organization IDs come from the users sequence so an asset's uid names either
+-- a user or an organization namespace without ambiguity.
+CREATE TABLE IF NOT EXISTS organizations (
+    id BIGINT PRIMARY KEY DEFAULT nextval('users_id_seq'),
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    org_id BIGINT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    uid BIGINT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, uid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_uid ON organization_members (uid);
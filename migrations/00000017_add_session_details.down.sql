@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_sessions_public_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE sessions DROP COLUMN IF EXISTS public_id;
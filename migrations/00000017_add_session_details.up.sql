@@ -0,0 +1,6 @@
+-- Session IDs are the bearer tokens themselves, so sessions are listed and
+-- revoked by a separate public ID.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS public_id TEXT NOT NULL DEFAULT encode(gen_random_bytes(8), 'hex');
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_public_id ON sessions (public_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_session_id;
+DROP TABLE IF EXISTS refresh_tokens;
+ALTER TABLE sessions DROP COLUMN IF EXISTS refresh_expires_at;
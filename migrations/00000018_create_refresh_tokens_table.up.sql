@@ -0,0 +1,15 @@
+-- A session can be renewed with refresh tokens until refresh_expires_at.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS refresh_expires_at TIMESTAMPTZ;
+UPDATE sessions SET refresh_expires_at = expires_at WHERE refresh_expires_at IS NULL;
+ALTER TABLE sessions ALTER COLUMN refresh_expires_at SET NOT NULL;
+
+-- The refresh tokens of a session form a family: each refresh uses up one
+-- token and issues the next. Reusing a spent token revokes the session.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions (public_id) ON DELETE CASCADE,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
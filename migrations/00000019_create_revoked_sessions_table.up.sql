@@ -0,0 +1,5 @@
+-- Sessions whose signed access tokens must be rejected until they expire.
+CREATE TABLE IF NOT EXISTS revoked_sessions (
+    session_id TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_login_lockouts_created_at;
+DROP TABLE IF EXISTS login_lockouts;
+DROP INDEX IF EXISTS idx_login_failures_last_failure_at;
+DROP TABLE IF EXISTS login_failures;
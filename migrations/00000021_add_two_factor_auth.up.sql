@@ -0,0 +1,23 @@
+-- totp_secret is set while enrolling and kept once totp_enabled is set.
+-- totp_last_step is the time step of the last accepted code, codes can't be
+-- replayed.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    uid BIGINT NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    PRIMARY KEY (uid, code_hash)
+);
+
+-- Logins that passed the password check and wait for the second factor.
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    token_hash TEXT PRIMARY KEY,
+    uid BIGINT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_two_factor_challenges_expires_at ON two_factor_challenges (expires_at);
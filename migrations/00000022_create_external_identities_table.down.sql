@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS oidc_login_states;
+DROP INDEX IF EXISTS idx_external_identities_uid;
+DROP TABLE IF EXISTS external_identities;
+-- Users without a password can't be kept with the constraint.
+DELETE FROM users WHERE password_hash IS NULL;
+ALTER TABLE users ALTER COLUMN password_hash SET NOT NULL;
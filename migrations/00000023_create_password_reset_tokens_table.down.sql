@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_password_reset_tokens_expires_at;
+DROP INDEX IF EXISTS idx_password_reset_tokens_uid;
+DROP TABLE IF EXISTS password_reset_tokens;
@@ -0,0 +1,26 @@
+-- Logins used to be compared case-sensitively, so "alice" and "Alice" may both
+-- exist. The unique index can't be built until they are renamed, and which
+-- account keeps the name is for an operator to decide, so the migration stops
+-- and lists them. Rename all but one login of each group, e.g.
+--   UPDATE users SET login = 'Alice-2' WHERE id = ...;
+-- and run the migration again.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(logins, '; ')
+    INTO duplicates
+    FROM (
+        SELECT string_agg(format('%s (id %s)', login, id), ', ' ORDER BY id) AS logins
+        FROM users
+        GROUP BY lower(login)
+        HAVING count(*) > 1
+    ) groups;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'logins differing only in case must be renamed before they can be made case-insensitive: %', duplicates;
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_login_lower ON users (lower(login));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_admin_audit_log_created_at;
+DROP TABLE IF EXISTS admin_audit_log;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,14 @@
+-- The backend holding the blobs. Blob keys are only meaningful to the backend
+-- that issued them, so the service refuses to start with a different one.
+CREATE TABLE IF NOT EXISTS blob_backend (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    backend TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Numeric keys are large object OIDs written before the backend was
+-- configurable. Other keys are recorded on the next start.
+INSERT INTO blob_backend (backend)
+SELECT 'postgres'
+WHERE EXISTS (SELECT 1 FROM blobs WHERE blob_key ~ '^[0-9]+$')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+-- Finished uploads are kept until they expire, so a client can still see
+-- that the upload is complete after the last PATCH response got lost.
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
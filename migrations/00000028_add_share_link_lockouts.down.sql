@@ -0,0 +1,3 @@
+DELETE FROM login_lockouts WHERE kind = 'share_link';
+ALTER TABLE login_lockouts DROP CONSTRAINT IF EXISTS login_lockouts_kind_check;
+ALTER TABLE login_lockouts ADD CONSTRAINT login_lockouts_kind_check CHECK (kind IN ('account', 'ip'));
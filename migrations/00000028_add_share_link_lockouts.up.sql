@@ -0,0 +1,3 @@
+-- Wrong share link passwords are throttled like logins.
+ALTER TABLE login_lockouts DROP CONSTRAINT IF EXISTS login_lockouts_kind_check;
+ALTER TABLE login_lockouts ADD CONSTRAINT login_lockouts_kind_check CHECK (kind IN ('account', 'ip', 'share_link'));
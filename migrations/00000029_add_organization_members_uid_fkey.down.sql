@@ -0,0 +1 @@
+ALTER TABLE organization_members DROP CONSTRAINT IF EXISTS organization_members_uid_fkey;
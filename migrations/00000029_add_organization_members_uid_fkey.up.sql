@@ -0,0 +1,3 @@
+-- Memberships of deleted users must not outlive them.
+DELETE FROM organization_members m WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = m.uid);
+ALTER TABLE organization_members ADD CONSTRAINT organization_members_uid_fkey FOREIGN KEY (uid) REFERENCES users (id) ON DELETE CASCADE;
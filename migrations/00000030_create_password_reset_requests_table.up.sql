@@ -0,0 +1,9 @@
+-- Password reset requests are limited per address, including those for
+-- unknown logins.
+CREATE TABLE IF NOT EXISTS password_reset_requests (
+    id BIGSERIAL PRIMARY KEY,
+    ip_address TEXT NOT NULL,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_requests_ip_address ON password_reset_requests (ip_address, requested_at);
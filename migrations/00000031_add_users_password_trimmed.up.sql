@@ -0,0 +1,6 @@
+-- Passwords used to be trimmed before hashing. Only hashes from back then
+-- are checked against the trimmed password too, until the user logs in and
+-- the password is rehashed as entered.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_trimmed BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET password_trimmed = TRUE WHERE password_hash IS NOT NULL;
@@ -0,0 +1,2 @@
+DELETE FROM admin_audit_log WHERE admin_uid IS NULL;
+ALTER TABLE admin_audit_log ALTER COLUMN admin_uid SET NOT NULL;
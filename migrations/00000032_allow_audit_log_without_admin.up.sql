@@ -0,0 +1,2 @@
+-- The admin role given from ADMIN_LOGINS is recorded without an admin.
+ALTER TABLE admin_audit_log ALTER COLUMN admin_uid DROP NOT NULL;